@@ -0,0 +1,330 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// redis cluster 的哈希槽总数
+	clusterSlots = 16384
+	// 单次命令最多跟随的 MOVED/ASK 重定向次数
+	clusterMaxRedirects = 5
+)
+
+// 基于 redis cluster 的 LockClient，根据 key 的哈希槽将命令路由到对应的节点，并处理 MOVED/ASK 重定向
+// 锁相关的 lua 脚本均为单 key 脚本，会在 key 所属槽位的节点上执行
+// 注意：cluster 仅提供分片与主从高可用，并不能替代红锁 RedLock，主从切换时锁仍可能丢失
+type ClusterClient struct {
+	password string
+	opts     []ClientOption
+	seeds    []string
+
+	mu    sync.RWMutex
+	slots [clusterSlots]string // 哈希槽 -> 节点地址
+	nodes map[string]*Client   // 节点地址 -> 节点客户端
+}
+
+// 创建 cluster 客户端，addrs 为任意若干个集群节点地址，用于获取集群的槽位分布
+// opts 作用于每一个节点的客户端
+func NewClusterClient(addrs []string, password string, opts ...ClientOption) (*ClusterClient, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("cluster addresses are empty")
+	}
+
+	c := ClusterClient{
+		password: password,
+		opts:     opts,
+		seeds:    addrs,
+		nodes:    make(map[string]*Client),
+	}
+	if err := c.refreshSlots(context.Background()); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *ClusterClient) SetNX(ctx context.Context, key, value string, expireSeconds int64) (int64, error) {
+	return c.setNX(ctx, key, value, "EX", expireSeconds)
+}
+
+func (c *ClusterClient) SetNXPX(ctx context.Context, key, value string, expireMilliseconds int64) (int64, error) {
+	return c.setNX(ctx, key, value, "PX", expireMilliseconds)
+}
+
+func (c *ClusterClient) setNX(ctx context.Context, key, value, unit string, expire int64) (int64, error) {
+	if key == "" {
+		return -1, ErrEmptyKey
+	}
+	if value == "" {
+		return -1, ErrEmptyValue
+	}
+
+	reply, err := c.do(ctx, key, func(_ *Client, conn redis.Conn) (interface{}, error) {
+		return conn.Do("SET", key, value, unit, expire, "NX")
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	if respStr, ok := reply.(string); ok && strings.ToLower(respStr) == "ok" {
+		return 1, nil
+	}
+	return redis.Int64(reply, err)
+}
+
+// 在 key 所属的节点上执行 SET NX PX 与 WAIT
+func (c *ClusterClient) SetNXPXWait(ctx context.Context, key, value string, expireMilliseconds int64, numReplicas int, timeout time.Duration) (int64, int64, error) {
+	if key == "" {
+		return -1, 0, ErrEmptyKey
+	}
+	if value == "" {
+		return -1, 0, ErrEmptyValue
+	}
+
+	var reply, acked int64
+	_, err := c.do(ctx, key, func(_ *Client, conn redis.Conn) (interface{}, error) {
+		var err error
+		reply, acked, err = setNXPXWaitOnConn(conn, key, value, expireMilliseconds, numReplicas, timeout)
+		return nil, err
+	})
+	if err != nil {
+		// SET NX 成功而 WAIT 失败时 reply 为 1
+		return reply, 0, err
+	}
+	return reply, acked, nil
+}
+
+// 以第一个 key 所属的槽位路由，无 key 的脚本(如发布解锁通知)可在任意节点执行
+// 多 key 脚本要求所有 key 位于同一槽位，可借助 hash tag({...}) 保证
+func (c *ClusterClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	var key string
+	if keyCount > 0 && len(keyAndArgs) > 0 {
+		key = fmt.Sprint(keyAndArgs[0])
+	}
+
+	return c.do(ctx, key, func(node *Client, conn redis.Conn) (interface{}, error) {
+		return node.evalOnConn(ctx, conn, src, keyCount, keyAndArgs)
+	})
+}
+
+func (c *ClusterClient) PTTL(ctx context.Context, key string) (int64, error) {
+	if key == "" {
+		return -1, ErrEmptyKey
+	}
+
+	return redis.Int64(c.do(ctx, key, func(_ *Client, conn redis.Conn) (interface{}, error) {
+		return conn.Do("PTTL", key)
+	}))
+}
+
+func (c *ClusterClient) Get(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+
+	return getString(c.do(ctx, key, func(_ *Client, conn redis.Conn) (interface{}, error) {
+		return conn.Do("GET", key)
+	}))
+}
+
+func (c *ClusterClient) Del(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	_, err := c.do(ctx, key, func(_ *Client, conn redis.Conn) (interface{}, error) {
+		return conn.Do("DEL", key)
+	})
+	return err
+}
+
+// 关闭所有节点的连接池
+func (c *ClusterClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for _, node := range c.nodes {
+		if _err := node.Close(); _err != nil {
+			err = _err
+		}
+	}
+	return err
+}
+
+// 在 key 所属的节点上执行命令，遇到 MOVED 时更新槽位并重试，遇到 ASK 时先发送 ASKING 再在目标节点重试
+func (c *ClusterClient) do(ctx context.Context, key string, fn func(node *Client, conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	slot := ClusterSlot(key)
+	addr := c.slotAddr(slot)
+	var asking bool
+
+	for i := 0; i <= clusterMaxRedirects; i++ {
+		node := c.node(addr)
+		conn, err := node.getConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if asking {
+			if _, err = conn.Do("ASKING"); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		reply, err := fn(node, conn)
+		conn.Close()
+
+		kind, target, ok := parseRedirect(err)
+		if !ok {
+			return reply, err
+		}
+
+		addr, asking = target, kind == "ASK"
+		if kind == "MOVED" {
+			// 槽位已迁移到新节点，更新本地槽位表
+			c.mu.Lock()
+			c.slots[slot] = target
+			c.mu.Unlock()
+		}
+	}
+	return nil, fmt.Errorf("too many cluster redirects for key %q", key)
+}
+
+// 获取槽位对应的节点地址，槽位未知时使用第一个种子节点，依靠 MOVED 重定向纠正
+func (c *ClusterClient) slotAddr(slot int) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if addr := c.slots[slot]; addr != "" {
+		return addr
+	}
+	return c.seeds[0]
+}
+
+// 获取节点客户端，不存在时创建
+func (c *ClusterClient) node(addr string) *Client {
+	c.mu.RLock()
+	node, ok := c.nodes[addr]
+	c.mu.RUnlock()
+	if ok {
+		return node
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node, ok = c.nodes[addr]; ok {
+		return node
+	}
+	node = NewClient("tcp", addr, c.password, c.opts...)
+	c.nodes[addr] = node
+	return node
+}
+
+// 依次向种子节点执行 CLUSTER SLOTS，获取集群的槽位分布
+func (c *ClusterClient) refreshSlots(ctx context.Context) error {
+	var err error
+	for _, seed := range c.seeds {
+		var reply []interface{}
+		if reply, err = c.clusterSlots(ctx, seed); err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, item := range reply {
+			// 每一项为 [起始槽位, 结束槽位, [主节点 ip, 主节点端口, ...], 从节点...]
+			info, _ := redis.Values(item, nil)
+			if len(info) < 3 {
+				continue
+			}
+			start, _ := redis.Int(info[0], nil)
+			end, _ := redis.Int(info[1], nil)
+			master, _ := redis.Values(info[2], nil)
+			if len(master) < 2 {
+				continue
+			}
+			host, _ := redis.String(master[0], nil)
+			port, _ := redis.Int(master[1], nil)
+			addr := net.JoinHostPort(host, strconv.Itoa(port))
+			for slot := start; slot <= end && slot < clusterSlots; slot++ {
+				c.slots[slot] = addr
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("refresh cluster slots failed: %w", err)
+}
+
+func (c *ClusterClient) clusterSlots(ctx context.Context, addr string) ([]interface{}, error) {
+	conn, err := c.node(addr).getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return redis.Values(conn.Do("CLUSTER", "SLOTS"))
+}
+
+// 解析 MOVED/ASK 重定向错误，格式为 "MOVED 3999 127.0.0.1:6381"
+func parseRedirect(err error) (kind, addr string, ok bool) {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return "", "", false
+	}
+
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", "", false
+	}
+	return fields[0], fields[2], true
+}
+
+// 计算 key 所属的哈希槽，key 中包含非空的 hash tag({...}) 时仅对 tag 内的内容计算
+func ClusterSlot(key string) int {
+	return int(crc16(clusterHashTag(key)) % clusterSlots)
+}
+
+// 参与哈希槽计算的部分：非空的 hash tag，没有 hash tag 时为整个 key
+func clusterHashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// 返回与 slotKey 位于同一槽位的 key：key 已与 slotKey 同槽位时原样返回，否则追加 slotKey 的 hash tag
+// 供多 key 脚本使用，避免 cluster 模式下出现 CROSSSLOT 错误
+func sameSlotKey(key, slotKey string) string {
+	if ClusterSlot(key) == ClusterSlot(slotKey) {
+		return key
+	}
+	return key + "{" + clusterHashTag(slotKey) + "}"
+}
+
+// CRC16-CCITT(XMODEM)，redis cluster 计算哈希槽使用的校验算法
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,351 @@
+package redislock
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 基于内存的 LockClient，用于无需真实 redis 的单元测试
+// 支持 SET NX、GET、DEL、PTTL，以及锁的加锁、解锁、续约、归属权校验、转移、受锁保护数据的读写等内置 lua 脚本(按脚本源码识别，并不解释执行 lua)
+// 读写锁、信号量、公平锁的脚本及自定义脚本不受支持，执行时返回错误
+// 过期时间基于可注入的时钟计算，测试时可通过 SetClock 推进时间，模拟锁的过期
+type FakeClient struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	data map[string]*fakeEntry
+}
+
+// 内存中的一个 key，字符串或 hash(可重入锁)
+type fakeEntry struct {
+	value    string
+	hash     map[string]int64
+	expireAt time.Time // 零值代表永不过期
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		now:  time.Now,
+		data: make(map[string]*fakeEntry),
+	}
+}
+
+// 指定 FakeClient 使用的时钟，key 的过期以该时钟判断
+func (c *FakeClient) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func (c *FakeClient) SetNX(ctx context.Context, key, value string, expireSeconds int64) (int64, error) {
+	return c.setNX(key, value, time.Duration(expireSeconds)*time.Second)
+}
+
+func (c *FakeClient) SetNXPX(ctx context.Context, key, value string, expireMilliseconds int64) (int64, error) {
+	return c.setNX(key, value, time.Duration(expireMilliseconds)*time.Millisecond)
+}
+
+func (c *FakeClient) setNX(key, value string, expire time.Duration) (int64, error) {
+	if key == "" {
+		return -1, ErrEmptyKey
+	}
+	if value == "" {
+		return -1, ErrEmptyValue
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.setNXLocked(key, value, expire) {
+		// 与 redigo 保持一致，SET NX 失败时返回 ErrNil
+		return 0, ErrNil
+	}
+	return 1, nil
+}
+
+func (c *FakeClient) PTTL(ctx context.Context, key string) (int64, error) {
+	if key == "" {
+		return -1, ErrEmptyKey
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pttlLocked(key), nil
+}
+
+func (c *FakeClient) Get(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.getLocked(key)
+	if entry == nil {
+		return "", ErrKeyNotFound
+	}
+	if entry.hash != nil {
+		return "", redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	return entry.value, nil
+}
+
+func (c *FakeClient) Del(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+// 检查连通性，FakeClient 总是可用
+func (c *FakeClient) Ping(ctx context.Context) error {
+	return nil
+}
+
+// 按脚本源码识别内置脚本，在内存中模拟其执行结果
+func (c *FakeClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	if keyCount < 0 || keyCount > len(keyAndArgs) {
+		return -1, fmt.Errorf("invalid key count %d", keyCount)
+	}
+	keys := make([]string, 0, keyCount)
+	for _, key := range keyAndArgs[:keyCount] {
+		keys = append(keys, fmt.Sprint(key))
+	}
+	args := make([]string, 0, len(keyAndArgs)-keyCount)
+	for _, arg := range keyAndArgs[keyCount:] {
+		args = append(args, fmt.Sprint(arg))
+	}
+	// 缺省的参数按空字符串处理
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	key := func(i int) string {
+		if i < len(keys) {
+			return keys[i]
+		}
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch src {
+	case LuaCheckAndDeleteDistributionLock:
+		if !c.ownedLocked(key(0), arg(0)) {
+			return int64(0), nil
+		}
+		delete(c.data, key(0))
+		return int64(1), nil
+
+	case LuaCheckAndExpireDistributionLock, LuaCheckAndPExpireDistributionLock:
+		unit := time.Millisecond
+		if src == LuaCheckAndExpireDistributionLock {
+			unit = time.Second
+		}
+		duration, err := strconv.ParseInt(arg(1), 10, 64)
+		if err != nil || duration <= 0 || !c.ownedLocked(key(0), arg(0)) {
+			return int64(0), nil
+		}
+		return c.expireLocked(key(0), time.Duration(duration)*unit), nil
+
+	case LuaReentrantLock:
+		entry := c.getLocked(key(0))
+		if entry != nil && (entry.hash == nil || entry.hash[arg(0)] == 0) {
+			return int64(0), nil
+		}
+		duration, _ := strconv.ParseInt(arg(1), 10, 64)
+		if entry == nil {
+			entry = &fakeEntry{hash: make(map[string]int64)}
+			c.data[key(0)] = entry
+		}
+		entry.hash[arg(0)]++
+		c.expireLocked(key(0), time.Duration(duration)*time.Millisecond)
+		return int64(1), nil
+
+	case LuaReentrantUnlock:
+		entry := c.getLocked(key(0))
+		if entry == nil || entry.hash == nil || entry.hash[arg(0)] == 0 {
+			return int64(-1), nil
+		}
+		entry.hash[arg(0)]--
+		if count := entry.hash[arg(0)]; count > 0 {
+			return count, nil
+		}
+		delete(c.data, key(0))
+		return int64(0), nil
+
+	case LuaReentrantExpire:
+		entry := c.getLocked(key(0))
+		duration, err := strconv.ParseInt(arg(1), 10, 64)
+		if entry == nil || entry.hash == nil || entry.hash[arg(0)] <= 0 || err != nil || duration <= 0 {
+			return int64(0), nil
+		}
+		return c.expireLocked(key(0), time.Duration(duration)*time.Millisecond), nil
+
+	case LuaCheckOwnership:
+		if c.holdsLocked(key(0), arg(0)) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+
+	case LuaGuardedSet:
+		if !c.holdsLocked(key(0), arg(0)) {
+			return int64(0), nil
+		}
+		c.data[key(1)] = &fakeEntry{value: arg(1)}
+		return int64(1), nil
+
+	case LuaGuardedGet:
+		if !c.holdsLocked(key(0), arg(0)) {
+			return int64(0), nil
+		}
+		if entry := c.getLocked(key(1)); entry != nil && entry.hash == nil {
+			return []interface{}{int64(1), entry.value}, nil
+		}
+		return []interface{}{int64(1)}, nil
+
+	case LuaPublishUnlockNotify:
+		// FakeClient 不支持订阅，没有订阅方
+		return int64(0), nil
+
+	case LuaAcquireReturnOwner:
+		duration, _ := strconv.ParseInt(arg(1), 10, 64)
+		if c.setNXLocked(key(0), arg(0), time.Duration(duration)*time.Millisecond) {
+			return int64(1), nil
+		}
+		if entry := c.getLocked(key(0)); entry != nil && entry.hash == nil {
+			return entry.value, nil
+		}
+		return int64(0), nil
+
+	case LuaTransferLock:
+		if !c.ownedLocked(key(0), arg(0)) {
+			return int64(0), nil
+		}
+		entry := c.data[key(0)]
+		_, metadata := decodeLockValue(entry.value)
+		entry.value = encodeLockValue(arg(1), metadata)
+		return int64(1), nil
+
+	case LuaReentrantTransfer:
+		entry := c.getLocked(key(0))
+		if entry == nil || entry.hash == nil || entry.hash[arg(0)] == 0 {
+			return int64(0), nil
+		}
+		entry.hash[arg(1)] += entry.hash[arg(0)]
+		delete(entry.hash, arg(0))
+		return int64(1), nil
+
+	case LuaWaiterEnter:
+		count := int64(1)
+		if entry := c.getLocked(key(0)); entry != nil {
+			n, _ := strconv.ParseInt(entry.value, 10, 64)
+			count = n + 1
+		}
+		duration, _ := strconv.ParseInt(arg(0), 10, 64)
+		c.data[key(0)] = &fakeEntry{value: strconv.FormatInt(count, 10)}
+		c.expireLocked(key(0), time.Duration(duration)*time.Millisecond)
+		return count, nil
+
+	case LuaWaiterLeave:
+		entry := c.getLocked(key(0))
+		if entry == nil {
+			return int64(0), nil
+		}
+		count, _ := strconv.ParseInt(entry.value, 10, 64)
+		if count <= 1 {
+			delete(c.data, key(0))
+			return int64(0), nil
+		}
+		entry.value = strconv.FormatInt(count-1, 10)
+		return count - 1, nil
+
+	case LuaMultiLock:
+		for _, k := range keys {
+			if c.getLocked(k) != nil {
+				return int64(0), nil
+			}
+		}
+		duration, _ := strconv.ParseInt(arg(1), 10, 64)
+		for _, k := range keys {
+			c.setNXLocked(k, arg(0), time.Duration(duration)*time.Millisecond)
+		}
+		return int64(1), nil
+	}
+	return -1, fmt.Errorf("script is not supported by FakeClient: %.40q", src)
+}
+
+// 获取未过期的 key，已过期的 key 被删除，调用方需持有 c.mu
+func (c *FakeClient) getLocked(key string) *fakeEntry {
+	entry, ok := c.data[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expireAt.IsZero() && !c.now().Before(entry.expireAt) {
+		delete(c.data, key)
+		return nil
+	}
+	return entry
+}
+
+func (c *FakeClient) setNXLocked(key, value string, expire time.Duration) bool {
+	if c.getLocked(key) != nil {
+		return false
+	}
+	entry := &fakeEntry{value: value}
+	if expire > 0 {
+		entry.expireAt = c.now().Add(expire)
+	}
+	c.data[key] = entry
+	return true
+}
+
+// 字符串类型的锁是否归属于 token，锁的值中附带元数据时只比较 token 部分
+func (c *FakeClient) ownedLocked(key, token string) bool {
+	entry := c.getLocked(key)
+	if entry == nil || entry.hash != nil {
+		return false
+	}
+	owner, _ := decodeLockValue(entry.value)
+	return owner == token
+}
+
+// 锁(普通锁或可重入锁)是否归属于 token
+func (c *FakeClient) holdsLocked(key, token string) bool {
+	if entry := c.getLocked(key); entry != nil && entry.hash != nil {
+		return entry.hash[token] > 0
+	}
+	return c.ownedLocked(key, token)
+}
+
+// 设置 key 的过期时间，返回设置后的剩余过期时间(毫秒)
+func (c *FakeClient) expireLocked(key string, expire time.Duration) int64 {
+	entry := c.getLocked(key)
+	if entry == nil {
+		return 0
+	}
+	entry.expireAt = c.now().Add(expire)
+	return c.pttlLocked(key)
+}
+
+// 与 PTTL 一致：key 不存在返回 -2，未设置过期时间返回 -1
+func (c *FakeClient) pttlLocked(key string) int64 {
+	entry := c.getLocked(key)
+	if entry == nil {
+		return -2
+	}
+	if entry.expireAt.IsZero() {
+		return -1
+	}
+	return entry.expireAt.Sub(c.now()).Milliseconds()
+}
@@ -0,0 +1,168 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// 基于 go-redis v9 实现的 LockClient，复用业务已有的 *redis.Client 连接池，无需再额外创建 redigo 连接池
+// 返回值语义与 Client 保持一致：SET NX 失败时返回 ErrNil，GET 的 key 不存在时返回 ErrKeyNotFound
+type GoRedisClient struct {
+	client *goredis.Client
+}
+
+func NewGoRedisClient(client *goredis.Client) LockClient {
+	return &GoRedisClient{client: client}
+}
+
+func (c *GoRedisClient) SetNX(ctx context.Context, key, value string, expireSeconds int64) (int64, error) {
+	return c.setNX(ctx, key, value, time.Duration(expireSeconds)*time.Second)
+}
+
+func (c *GoRedisClient) SetNXPX(ctx context.Context, key, value string, expireMilliseconds int64) (int64, error) {
+	return c.setNX(ctx, key, value, time.Duration(expireMilliseconds)*time.Millisecond)
+}
+
+// go-redis 会根据过期时间是否为整秒，自动选择 EX 或 PX
+func (c *GoRedisClient) setNX(ctx context.Context, key, value string, expire time.Duration) (int64, error) {
+	if key == "" {
+		return -1, ErrEmptyKey
+	}
+	if value == "" {
+		return -1, ErrEmptyValue
+	}
+
+	ok, err := c.client.SetNX(ctx, key, value, expire).Result()
+	if err != nil {
+		return -1, convertGoRedisErr(err)
+	}
+	// 与 redigo 保持一致，SET NX 失败时返回 ErrNil
+	if !ok {
+		return -1, ErrNil
+	}
+	return 1, nil
+}
+
+// pipeline 中的命令在同一连接上执行，WAIT 等待的即是本次 SET NX 的写入；SET NX 失败时 WAIT 会立即返回
+func (c *GoRedisClient) SetNXPXWait(ctx context.Context, key, value string, expireMilliseconds int64, numReplicas int, timeout time.Duration) (int64, int64, error) {
+	if key == "" {
+		return -1, 0, ErrEmptyKey
+	}
+	if value == "" {
+		return -1, 0, ErrEmptyValue
+	}
+
+	pipe := c.client.Pipeline()
+	setCmd := pipe.SetNX(ctx, key, value, time.Duration(expireMilliseconds)*time.Millisecond)
+	waitCmd := pipe.Do(ctx, "WAIT", numReplicas, timeout.Milliseconds())
+	if _, err := pipe.Exec(ctx); err != nil {
+		// pipeline 返回首个失败命令的错误，SET NX 成功而 WAIT 失败时需告知调用方锁已写入
+		if setCmd.Err() == nil && setCmd.Val() {
+			return 1, 0, convertGoRedisErr(err)
+		}
+		return -1, 0, convertGoRedisErr(err)
+	}
+	if !setCmd.Val() {
+		return -1, 0, ErrNil
+	}
+	acked, err := waitCmd.Int64()
+	if err != nil {
+		return 1, 0, convertGoRedisErr(err)
+	}
+	return 1, acked, nil
+}
+
+// keyAndArgs 中前 keyCount 个为 key，其余为参数；脚本通过 EVALSHA 执行，NOSCRIPT 时由 go-redis 回退至 EVAL
+func (c *GoRedisClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	if keyCount > len(keyAndArgs) {
+		return -1, fmt.Errorf("keyCount %d exceeds keyAndArgs length %d", keyCount, len(keyAndArgs))
+	}
+
+	keys := make([]string, 0, keyCount)
+	for _, key := range keyAndArgs[:keyCount] {
+		keys = append(keys, fmt.Sprint(key))
+	}
+
+	reply, err := goredis.NewScript(src).Run(ctx, c.client, keys, keyAndArgs[keyCount:]...).Result()
+	if err != nil {
+		return -1, convertGoRedisErr(err)
+	}
+	return reply, nil
+}
+
+func (c *GoRedisClient) PTTL(ctx context.Context, key string) (int64, error) {
+	if key == "" {
+		return -1, ErrEmptyKey
+	}
+
+	ttl, err := c.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return -1, convertGoRedisErr(err)
+	}
+	// key 不存在(-2)、未设置过期时间(-1) 时，go-redis 直接返回原始值
+	if ttl == -2 || ttl == -1 {
+		return int64(ttl), nil
+	}
+	return ttl.Milliseconds(), nil
+}
+
+func (c *GoRedisClient) Get(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", ErrEmptyKey
+	}
+
+	v, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", ErrKeyNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+func (c *GoRedisClient) Del(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	return convertGoRedisErr(c.client.Del(ctx, key).Err())
+}
+
+// 检查 redis 的连通性
+func (c *GoRedisClient) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// 订阅 channel，实现 NotifyClient，支持 WithNotifyWait 模式
+func (c *GoRedisClient) Subscribe(ctx context.Context, channel string) (<-chan struct{}, func(), error) {
+	ps := c.client.Subscribe(ctx, channel)
+	// 等待订阅确认，确保订阅已建立
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return nil, nil, err
+	}
+
+	notifyCh := make(chan struct{}, 1)
+	go func() {
+		defer close(notifyCh)
+		for range ps.Channel() {
+			select {
+			case notifyCh <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return notifyCh, func() { ps.Close() }, nil
+}
+
+// 将 go-redis 的 redis.Nil 转换为 ErrNil，使上层的错误判断与 redigo 客户端一致
+func convertGoRedisErr(err error) error {
+	if errors.Is(err, goredis.Nil) {
+		return ErrNil
+	}
+	return err
+}
@@ -2,20 +2,87 @@ package redislock
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"redis_lock/utils"
-	"sync/atomic"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
-// 用于与 key 拼接，形成真正插入 redis 的 key
+// 用于与 key 拼接，形成真正插入 redis 的 key，可通过 WithKeyPrefix 替换
 const RedisLockKeyPrefix = "REDIS_LOCK_PREFIX_"
 
+// 用于与 key 拼接，形成解锁通知的 channel
+const RedisLockNotifyPrefix = "REDIS_LOCK_NOTIFY_"
+
+// 用于与 key 拼接，形成公平锁模式下的等锁队列
+const RedisLockQueuePrefix = "REDIS_LOCK_QUEUE_"
+
+// 用于与 key 拼接，形成 WithContentionTracking 模式下的等锁计数
+const RedisLockWaitersPrefix = "REDIS_LOCK_WAITERS_"
+
 var ErrLockAcquiredByOthers = errors.New("lock is acquired by others")
 
+// 锁不存在(未加锁或已过期)，或不再持有锁的归属权
+var ErrLockNotHeld = errors.New("lock is not held")
+
+// 显式指定的锁过期时间不合法(<= 0)
+var ErrInvalidExpire = errors.New("lock expire must be positive")
+
+// WithExpireAt 指定的过期时刻已过
+var ErrExpireAtPassed = errors.New("lock expire time has passed")
+
+// WithNotifyChannel 生成的解锁通知 channel 为空
+var ErrEmptyNotifyChannel = errors.New("notify channel must not be empty")
+
+// 锁续约失败
+var ErrRenewFailed = errors.New("lock renew failed")
+
+// WithReplicationWait 模式下，WAIT 超时时确认写入锁的从节点数不足
+var ErrReplicationTimeout = errors.New("lock is not acknowledged by enough replicas")
+
+// 看门狗错误通道的默认缓冲区大小
+const watchDogErrChanSize = 1
+
+// 错误通道缓冲区已满时的丢弃策略
+type DropPolicy int
+
+const (
+	// 丢弃最新的错误，保留缓冲区中较早的错误(默认)
+	DropNewest DropPolicy = iota
+	// 丢弃缓冲区中最早的错误，保证读取方总能读到最近的错误
+	DropOldest
+)
+
+// 看门狗(或归属权检查)退出的原因
+type WatchDogStopReason int
+
+const (
+	// 被 Unlock 停止
+	WatchDogStoppedByUnlock WatchDogStopReason = iota
+	// WithWatchDogContext 指定的 ctx 结束
+	WatchDogStoppedByContext
+	// 归属权检查发现锁已丢失
+	WatchDogStoppedByLockLost
+)
+
+func (r WatchDogStopReason) String() string {
+	switch r {
+	case WatchDogStoppedByUnlock:
+		return "unlock"
+	case WatchDogStoppedByContext:
+		return "context done"
+	case WatchDogStoppedByLockLost:
+		return "lock lost"
+	}
+	return fmt.Sprintf("WatchDogStopReason(%d)", int(r))
+}
+
 // 发生 redis.ErrNil 错误时，要进行重试
 var ErrNil = redis.ErrNil
 
@@ -23,26 +90,67 @@ func IsRetryableErr(err error) bool {
 	return errors.Is(err, ErrLockAcquiredByOthers)
 }
 
-// 基于 redis 实现的分布式锁，保证不可重入性、对称性
+// 判断错误是否由于不持有锁导致
+func IsLockNotHeld(err error) bool {
+	return errors.Is(err, ErrLockNotHeld)
+}
+
+// 锁被他人持有的错误，包含当前持有者的 token，errors.Is 可匹配 ErrLockAcquiredByOthers
+// 开启 WithOwnerDiagnostics 时返回
+type LockHeldError struct {
+	Key   string
+	Owner string
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("lock %s is held by %s", e.Key, e.Owner)
+}
+
+func (e *LockHeldError) Is(target error) bool {
+	return target == ErrLockAcquiredByOthers
+}
+
+// 续约失败的错误，errors.Is 可同时匹配 ErrRenewFailed 与失败原因(如 ErrLockNotHeld)
+type renewError struct {
+	cause error
+}
+
+func (e *renewError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrRenewFailed, e.cause)
+}
+
+func (e *renewError) Is(target error) bool {
+	return target == ErrRenewFailed
+}
+
+func (e *renewError) Unwrap() error {
+	return e.cause
+}
+
+// 基于 redis 实现的分布式锁，保证对称性；默认不可重入，可通过 WithReentrant 开启可重入
+// 同一实例可在多个协程间并发使用，也可在 Unlock 后再次 Lock；同一实例的所有协程共用同一个 token
 type RedisLock struct {
 	LockOptions
 	key    string
-	token  string // 当前加锁协程唯一标识
 	client LockClient
 
-	runningDog int32              // 看门狗运行标识
-	stopDog    context.CancelFunc // 停止看门狗(的 context，关闭 Context.Done() channel)
+	// mu 保护看门狗状态，并串行化解锁与看门狗的启动：
+	// 避免同一实例上并发的 Lock/Unlock 交错，导致锁被重新持有时看门狗被解锁方关闭
+	mu      sync.Mutex
+	stopDog context.CancelFunc // 停止看门狗(的 context，关闭 Context.Done() channel)，非空代表看门狗正在运行
+	errCh   chan error         // 看门狗续约失败的错误通道，看门狗退出时关闭
+	dogDone chan struct{}      // 看门狗协程完全退出时关闭
 
-	logger *logx
+	deadlineMu sync.Mutex
+	deadline   time.Time // 锁名义上的过期时间，加锁、续约成功时更新，解锁时清空
+	acquiredAt time.Time // 加锁成功的时刻，可重入模式下为首次加锁的时刻，解锁时清空
 }
 
 // NewXxx 不带方法接收者，其作为工厂函数，创建对象；而不是作为对象自身的方法
 func NewRedisLock(key string, client LockClient, opts ...LockOption) *RedisLock {
 	r := RedisLock{
 		key:    key,
-		token:  utils.GetProcessAndGoroutineIDStr(),
 		client: client,
-		logger: newLogger(),
 	}
 
 	for _, opt := range opts {
@@ -50,145 +158,1036 @@ func NewRedisLock(key string, client LockClient, opts ...LockOption) *RedisLock
 		opt(&r.LockOptions)
 	}
 
+	// 优先使用用户指定的 token，未指定时默认为随机 UUID
 	repairLock(&r.LockOptions)
+	// 解锁通知 channel 依赖 key，无法在 repairLock 中校验
+	if r.err == nil && r.notifyWait && r.getNotifyChannel() == "" {
+		r.err = fmt.Errorf("%w, key: %s", ErrEmptyNotifyChannel, key)
+	}
+	if r.renewer == nil {
+		r.renewer = lockRenewer{r: &r}
+	}
 	return &r
 }
 
+// 一次加锁的过程信息，用于调优与排查竞争热点
+type LockResult struct {
+	Acquired     bool          // 是否加锁成功
+	Blocked      bool          // 首次取锁失败后是否进入了阻塞等锁
+	Attempts     int           // 尝试取锁的次数，包括首次取锁
+	WaitDuration time.Duration // 加锁的总耗时
+}
+
 // 加锁
-func (r *RedisLock) Lock(ctx context.Context) (err error) {
+func (r *RedisLock) Lock(ctx context.Context) error {
+	_, err := r.LockDetailed(ctx)
+	return err
+}
+
+// 加锁，与 Lock 相同，额外返回本次加锁是否发生了阻塞、尝试次数与耗时；加锁失败时同样返回已发生的过程信息
+func (r *RedisLock) LockDetailed(ctx context.Context) (LockResult, error) {
+	r.reset()
+	result, err := r.lockDetailed(ctx, r.tryLock)
+	if err != nil {
+		r.leaveQueue(ctx)
+	}
+	return result, err
+}
+
+// 加锁的完整流程(取锁超时、阻塞重试、启动看门狗)，tryLock 为单次取锁的实现，读写锁等可传入自身的取锁逻辑
+func (r *RedisLock) lock(ctx context.Context, tryLock func(ctx context.Context) error) error {
+	_, err := r.lockDetailed(ctx, tryLock)
+	return err
+}
+
+func (r *RedisLock) lockDetailed(ctx context.Context, tryLock func(ctx context.Context) error) (result LockResult, err error) {
+	// 选项校验失败，不尝试取锁
+	if r.err != nil {
+		return result, r.err
+	}
+
+	begin := time.Now()
 	defer func() {
+		result.Acquired = err == nil
+		result.WaitDuration = time.Since(begin)
+		r.metrics.OnAcquire(err == nil, result.WaitDuration)
 		if err != nil {
 			return
 		}
 		// TODO: 加锁成功，启动 watch dog
 		// 加锁成功的情况下，会启动看门狗
-		// 关于该锁本身是不可重入的，所以不会出现同一把锁下看门狗重复启动的情况
-		r.watchDog(ctx)
+		// 非可重入模式下不会出现同一把锁下看门狗重复启动的情况；可重入模式下由 watchDog 保证只启动一个看门狗
+		r.watchDog()
 	}()
 
+	// 设置了取锁超时时间时，整个取锁过程(包括非阻塞模式下的单次 redis 请求、阻塞模式下的重试)都受其约束
+	if r.acquireTimeout > 0 {
+		parentCtx := ctx
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parentCtx, r.acquireTimeout)
+		defer cancel()
+		defer func() {
+			// 由取锁超时(而非调用方 ctx)导致的失败，统一包装为 context.DeadlineExceeded
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil {
+				err = fmt.Errorf("acquire lock timeout after %v, last err: %v: %w", r.acquireTimeout, err, context.DeadlineExceeded)
+			}
+		}()
+	}
+
 	// 尝试获取锁
-	err = r.tryLock(ctx)
+	result.Attempts++
+	err = tryLock(ctx)
 	if err == nil {
-		return nil
+		return result, nil
 	}
 
 	// 非阻塞模式，直接返回错误
 	if !r.isBlock {
-		return err
+		return result, err
 	}
 
 	// 判断错误是否可以允许重试，不可允许的类型则直接返回错误、
 	if !IsRetryableErr(err) {
-		return err
+		return result, err
 	}
 
 	// 阻塞模式，轮询获取锁
-	err = r.blockingLock(ctx)
+	result.Blocked = true
+	err = r.blockingLock(ctx, tryLock, &result, err)
 	return
 }
 
-// 启动看门狗
-func (r *RedisLock) watchDog(ctx context.Context) {
-	// 非看门狗模式，直接返回
-	if !r.watchDogMode {
+// 非阻塞地尝试加锁一次
+// 加锁成功返回 (true, nil)；锁被他人持有返回 (false, nil)；仅在 redis/连接出错时返回 (false, err)
+func (r *RedisLock) TryLock(ctx context.Context) (acquired bool, err error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	r.reset()
+
+	begin := time.Now()
+	err = r.tryLock(ctx)
+	r.metrics.OnAcquire(err == nil, time.Since(begin))
+	if err != nil {
+		r.leaveQueue(ctx)
+	}
+	if IsRetryableErr(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// 加锁成功，与 Lock 一样启动看门狗
+	r.watchDog()
+	return true, nil
+}
+
+// 加锁后执行 fn，fn 返回或 panic 时均保证解锁，返回取锁错误或 fn 的错误(fn 成功时返回解锁错误)
+// 传给 fn 的 ctx 派生自调用方 ctx，看门狗续约时发现锁已不再持有(ErrLockNotHeld)会将其取消
+// 看门狗错误通道由 WithLock 消费，fn 内不应再读取 Errors()
+func (r *RedisLock) WithLock(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if err = r.Lock(ctx); err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		// 调用方 ctx 可能已取消，解锁使用独立的 ctx，保证锁一定被释放
+		if unlockErr := r.Unlock(context.Background()); err == nil {
+			err = unlockErr
+		}
+	}()
+	go cancelOnLockLost(fnCtx, r.Errors(), IsLockNotHeld, cancel)
+
+	return fn(fnCtx)
+}
+
+// 监听看门狗的错误通道，isLost 判定锁已丢失时取消 ctx；ctx 结束或通道关闭时退出
+func cancelOnLockLost(ctx context.Context, errCh <-chan error, isLost func(error) bool, cancel context.CancelFunc) {
+	if errCh == nil {
 		return
 	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errCh:
+			if !ok {
+				return
+			}
+			if isLost(err) {
+				cancel()
+				return
+			}
+		}
+	}
+}
 
-	// 确保在运行的看门狗的唯一性
-	// 一把锁只能由一个看门狗，去为其续约
-	for !atomic.CompareAndSwapInt32(&r.runningDog, 0, 1) {
+// 启动看门狗，非看门狗模式下开启了 WithOwnershipMonitor 时启动归属权检查
+func (r *RedisLock) watchDog() {
+	// 非看门狗模式，且未开启归属权检查，直接返回
+	if !r.watchDogMode && r.monitorInterval <= 0 {
+		return
 	}
 
-	// TODO *** 创建一个子 ctx，启动看门狗
-	ctx, r.stopDog = context.WithCancel(ctx)
-	// ctx, r.stopDog = context.WithTimeout(ctx, 30*time.Second)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 确保在运行的看门狗的唯一性，一把锁只能由一个看门狗去为其续约
+	// 可重入模式下重复加锁、或多个协程并发加锁时，看门狗已在为该锁续约，无需再次启动
+	if r.stopDog != nil {
+		return
+	}
+
+	// 看门狗的 ctx 派生自 watchDogCtx(默认为 context.Background())，而不是 Lock 传入的 ctx：
+	// 请求级 ctx 在 Lock 返回后可能很快被取消，若复用它，看门狗会随之停止续约，锁在持有期间过期
+	// 看门狗由 Unlock 调用 stopDog 停止，或随 watchDogCtx 结束而停止
+	var ctx context.Context
+	ctx, r.stopDog = context.WithCancel(r.watchDogCtx)
+	// 每次启动看门狗都创建新的错误通道，由看门狗协程负责关闭
+	errCh := make(chan error, r.errBufferSize)
+	r.errCh = errCh
+	done := make(chan struct{})
+	r.dogDone = done
 	go func() {
+		defer close(done)
+		r.onWatchDogStart()
 		defer func() {
-			atomic.StoreInt32(&r.runningDog, 0)
+			reason := r.watchDogStopReason(ctx)
+			close(errCh)
+			// 看门狗随 watchDogCtx 结束而退出时，清理运行状态，保证再次加锁时能重新启动看门狗
+			r.mu.Lock()
+			if r.errCh == errCh && r.stopDog != nil {
+				r.stopDog()
+				r.stopDog = nil
+			}
+			r.mu.Unlock()
+			r.onWatchDogStop(reason)
 		}()
-		r.runWatchDog(ctx)
+		if r.watchDogMode {
+			r.runWatchDog(ctx, errCh)
+			return
+		}
+		r.runOwnershipMonitor(ctx, errCh)
 	}()
 }
 
-func (r *RedisLock) runWatchDog(ctx context.Context) {
-	ticker := time.NewTicker(WatchDogWorkStepSeconds * time.Second)
+// 根据看门狗退出时 ctx 的状态判断退出原因：watchDogCtx 结束、被 Unlock 停止，或未被停止而自行退出(锁已丢失)
+func (r *RedisLock) watchDogStopReason(ctx context.Context) WatchDogStopReason {
+	switch {
+	case r.watchDogCtx.Err() != nil:
+		return WatchDogStoppedByContext
+	case ctx.Err() != nil:
+		return WatchDogStoppedByUnlock
+	}
+	return WatchDogStoppedByLockLost
+}
+
+// 获取看门狗续约失败的错误通道，需在加锁成功后调用
+// 每次续约失败都会向通道发送错误，业务方可监听该通道，在锁无法续约时及时中止任务
+// 通道的生命周期：每次加锁成功启动看门狗时创建新的通道；解锁、或看门狗随 watchDogCtx 结束退出时关闭
+// 通道带缓冲(默认为 1，可通过 WithErrorsBuffer 调整)，无人读取时续约不会被阻塞，缓冲区满时按丢弃策略丢弃错误
+// 解锁或看门狗退出后通道会被关闭；非看门狗模式下返回 nil(开启 WithOwnershipMonitor 时返回归属权检查的错误通道)
+func (r *RedisLock) Errors() <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errCh
+}
+
+func (r *RedisLock) runWatchDog(ctx context.Context, errCh chan error) {
+	r.log(ctx).Info("看门狗启动", "key", r.getLockKey(), "interval", r.watchDogInterval)
+	loop := renewLoop{
+		renewer:   r.renewer,
+		interval:  r.watchDogInterval,
+		immediate: r.immediateRenewal,
+		newTicker: r.newTicker,
+		onErr: func(err error) {
+			// 非阻塞发送，无人读取且通道已满时按丢弃策略丢弃，避免阻塞续约
+			sendErr(errCh, err, r.errDropPolicy)
+		},
+	}
+	loop.run(ctx)
+}
+
+// 默认的续约器，基于 DelayExpire 续约
+type lockRenewer struct {
+	r *RedisLock
+}
+
+// 每 watchDogInterval 续约一次，每次续约 2*watchDogInterval(多出一个间隔为了避免网络延迟，导致续约失败)
+func (l lockRenewer) Renew(ctx context.Context) error {
+	l.r.log(ctx).Debug("看门狗续约", "key", l.r.getLockKey())
+	return l.r.delayExpire(ctx, l.r.renewExpireDuration())
+}
+
+// 非阻塞地向错误通道发送错误，通道已满时按 policy 丢弃最新或最早的错误
+// 错误通道只由看门狗协程发送、并在其退出时关闭，因此不会向已关闭的通道发送
+func sendErr(errCh chan error, err error, policy DropPolicy) {
+	select {
+	case errCh <- err:
+		return
+	default:
+	}
+	if policy != DropOldest {
+		return
+	}
+	// 取出最早的错误腾出空间；读取方可能同时在读取，两步均需非阻塞
+	select {
+	case <-errCh:
+	default:
+	}
+	select {
+	case errCh <- err:
+	default:
+	}
+}
+
+// 周期性地检查锁是否仍由自己持有，发现锁已丢失时上报 ErrLockNotHeld 并退出
+func (r *RedisLock) runOwnershipMonitor(ctx context.Context, errCh chan error) {
+	ticker := time.NewTicker(r.monitorInterval)
 	defer ticker.Stop()
-	r.logger.Info("test1")
-	for range ticker.C {
-		r.logger.Info("test2")
+	r.log(ctx).Info("归属权检查启动", "key", r.getLockKey(), "interval", r.monitorInterval)
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
+		case <-ticker.C:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		owned, err := r.IsHeldByMe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && owned {
+			continue
+		}
+		if err == nil {
+			r.log(ctx).Error("归属权检查发现锁已丢失", "key", r.getLockKey())
+			err = fmt.Errorf("lock %s is no longer held: %w", r.getLockKey(), ErrLockNotHeld)
+		}
+		sendErr(errCh, err, r.errDropPolicy)
+		// 锁已丢失，无需继续检查
+		if IsLockNotHeld(err) {
+			return
 		}
-		// 每 WatchDogWorkStepSeconds 秒续约一次，每次续约 WatchDogWorkStepSeconds 秒(加 3 秒为了避免网络延迟，导致续约失败)
-		_ = r.DelayExpire(ctx, WatchDogWorkStepSeconds+3)
 	}
 }
 
 // 锁的续约，基于 lua 脚本
 func (r *RedisLock) DelayExpire(ctx context.Context, expireSeconds int64) error {
+	// 超出 time.Duration 表示范围的秒数在换算时会溢出为任意值
+	if expireSeconds > int64(math.MaxInt64/time.Second) {
+		return &renewError{cause: fmt.Errorf("%w, got: %ds", ErrInvalidExpire, expireSeconds)}
+	}
+	return r.delayExpire(ctx, time.Duration(expireSeconds)*time.Second)
+}
+
+// 锁的续约，整秒时使用 EXPIRE，非整秒时使用 PEXPIRE
+func (r *RedisLock) delayExpire(ctx context.Context, expire time.Duration) error {
+	// expire 0 会直接删除 key，续约时长必须为正
+	if expire <= 0 {
+		return &renewError{cause: fmt.Errorf("%w, got: %v", ErrInvalidExpire, expire)}
+	}
 	// TODO 不要写成 r.key！！！ 身份校验无法通过！
-	keyAndArgs := []interface{}{r.getLockKey(), r.token, expireSeconds}
-	reply, err := r.client.Eval(ctx, LuaCheckAndExpireDistributionLock, 1, keyAndArgs)
+	script, duration := LuaCheckAndExpireDistributionLock, int64(expire/time.Second)
+	switch {
+	case r.reentrant:
+		// 可重入模式下锁以 hash 存储，只要重入次数 > 0 就继续续约(毫秒)
+		script, duration = LuaReentrantExpire, expire.Milliseconds()
+	case r.renewScript != "":
+		script, duration = r.renewScript, expire.Milliseconds()
+	case expire%time.Second != 0:
+		script, duration = LuaCheckAndPExpireDistributionLock, expire.Milliseconds()
+	}
+	reply, err := r.client.Eval(ctx, script, 1, lockScriptArgs(r.getLockKey(), r.token, duration))
 
-	r.logger.Debug("续约触发", keyAndArgs, reply, err)
+	r.log(ctx).Debug("续约触发", "key", r.getLockKey(), "expire", expire, "reply", reply, "err", err)
+	if err != nil {
+		r.metrics.OnRenew(false)
+		r.log(ctx).Error("续约失败", "key", r.getLockKey(), "expire", expire, "err", err)
+		return &renewError{cause: err}
+	}
+	// 续约脚本返回续约后的剩余过期时间(毫秒)，0 代表不再持有锁
+	ttl, _ := reply.(int64)
+	if ttl <= 0 {
+		r.log(ctx).Error("续约失败，不再持有锁", "key", r.getLockKey(), "expire", expire, "reply", reply)
+		r.metrics.OnRenew(false)
+		return &renewError{cause: fmt.Errorf("can not expire lock without ownership of lock: %w", ErrLockNotHeld)}
+	}
+	// 校验续约确实将过期时间设置为了期望值，而不是被错误的参数类型、单位悄悄改变
+	if ttl > expire.Milliseconds() {
+		r.log(ctx).Error("续约后的过期时间与期望不符", "key", r.getLockKey(), "expire", expire, "ttl_ms", ttl)
+		r.metrics.OnRenew(false)
+		return &renewError{cause: fmt.Errorf("unexpected ttl %dms after renewal, expect at most %dms", ttl, expire.Milliseconds())}
+	}
+	r.log(ctx).Debug("续约成功", "key", r.getLockKey(), "ttl_ms", ttl)
+	r.setDeadline(time.Duration(ttl) * time.Millisecond)
+	r.metrics.OnRenew(true)
+	return nil
+}
+
+// 组装 KEYS[1] 为 key、ARGV[1] 为 token 的脚本参数，数值参数以 luaInt 格式化
+func lockScriptArgs(key, token string, nums ...int64) []interface{} {
+	keyAndArgs := make([]interface{}, 0, 2+len(nums))
+	keyAndArgs = append(keyAndArgs, key, token)
+	for _, n := range nums {
+		keyAndArgs = append(keyAndArgs, luaInt(n))
+	}
+	return keyAndArgs
+}
+
+// 传给 lua 脚本的数值参数统一格式化为十进制整数字符串，所有内置脚本的数值参数均经由此处
+// 不依赖客户端对各数值类型的格式化方式，脚本中再以 tonumber 转换，避免 expire/pexpire 收到非整数形式的时长
+func luaInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// 手动延长锁的租期，将锁的剩余过期时间设置为从现在起的 d(绝对设置，而非在剩余时间上累加)
+// 适用于非看门狗模式下，任务执行中途发现需要更多时间的场景；不再持有锁时返回 ErrLockNotHeld
+// 与 DelayExpire 不同：DelayExpire 供看门狗周期性续约使用，以秒为单位，失败返回 ErrRenewFailed；Extend 精确到毫秒
+func (r *RedisLock) Extend(ctx context.Context, d time.Duration) error {
+	if d.Milliseconds() <= 0 {
+		return fmt.Errorf("%w, got: %v", ErrInvalidExpire, d)
+	}
+	script := LuaCheckAndPExpireDistributionLock
+	if r.reentrant {
+		script = LuaReentrantExpire
+	} else if r.renewScript != "" {
+		script = r.renewScript
+	}
+	reply, err := r.client.Eval(ctx, script, 1, lockScriptArgs(r.getLockKey(), r.token, d.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	// 续期脚本返回续期后的剩余过期时间(毫秒)，0 代表不再持有锁
+	if ret, _ := reply.(int64); ret <= 0 {
+		return ErrLockNotHeld
+	}
+	r.setDeadline(d)
+	return nil
+}
+
+// 将锁的归属权原子地转移给 newToken，并保留锁的剩余过期时间，适用于任务迁移到其他 worker 等交接场景
+// 期间锁不会被释放，其他竞争者无法趁机取锁；新的持有者以 WithToken(newToken) 创建 RedisLock 后即可续约、解锁
+// 转移成功后当前 RedisLock 不再持有锁，看门狗随之停止；不再持有锁时返回 ErrLockNotHeld
+func (r *RedisLock) Transfer(ctx context.Context, newToken string) error {
+	if newToken == "" {
+		return ErrEmptyValue
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	script := LuaTransferLock
+	if r.reentrant {
+		script = LuaReentrantTransfer
+	}
+	keyAndArgs := []interface{}{r.getLockKey(), r.token, newToken}
+	reply, err := r.client.Eval(ctx, script, 1, keyAndArgs)
 	if err != nil {
-		r.logger.Error("续约失败", keyAndArgs, reply, err)
 		return err
 	}
 	if ret, _ := reply.(int64); ret != 1 {
-		r.logger.Error("续约失败2", keyAndArgs, reply, err)
-		return errors.New("can not expire lock without ownership of lock")
+		return fmt.Errorf("can not transfer lock without ownership of lock: %w", ErrLockNotHeld)
 	}
-	r.logger.Info("续约成功")
+
+	r.log(ctx).Info("锁的归属权已转移", "key", r.getLockKey(), "new_token", newToken)
+	r.stopWatchDogLocked()
+	r.setDeadline(0)
 	return nil
 }
 
+// 返回锁名义上的过期时间(最近一次加锁、续约的时间 + 过期时长)，以及该锁是否由看门狗自动续约
+// 未持有锁(未加锁、已解锁)时返回零值时间；看门狗模式下该时间会随续约不断后移
+// 过期时间以本地时钟计算，不包含网络延迟，仅供调度 Extend、提前中止任务等参考
+func (r *RedisLock) Deadline() (time.Time, bool) {
+	r.deadlineMu.Lock()
+	defer r.deadlineMu.Unlock()
+	return r.deadline, r.watchDogMode
+}
+
+// 锁是否由看门狗自动续约，即 repairLock 的最终决定，创建后不再变化
+// 仅在未指定过期时间(WithExpireSeconds/WithExpireDuration/WithExpireAt)且未 WithNoWatchDog 时为 true；
+// 为 false 时锁在过期时间后自动释放，任务可能超时的业务方需自行调用 Extend 延长租期
+func (r *RedisLock) IsWatchDogMode() bool {
+	return r.watchDogMode
+}
+
+// 复用实例再次加锁前，重置每次加锁的状态
+// 开启 WithTokenPerLock 且未持有锁时，等待上一次加锁的看门狗协程完全退出(不再读取旧 token)，再生成新的 token
+func (r *RedisLock) reset() {
+	if !r.tokenPerLock {
+		return
+	}
+	if deadline, _ := r.Deadline(); !deadline.IsZero() && time.Now().Before(deadline) {
+		// 仍持有锁，沿用当前 token
+		return
+	}
+
+	// 上一次加锁已丢失(续约失败)时看门狗仍在运行，先停止看门狗，否则其协程不会退出
+	r.mu.Lock()
+	r.stopWatchDogLocked()
+	done := r.dogDone
+	r.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dogDone = nil
+	r.token = r.newToken()
+	r.lockValue = encodeLockValue(r.token, r.metadata)
+}
+
+// 以当前时间 + ttl 更新锁的过期时间，ttl 为 0 时清空
+func (r *RedisLock) setDeadline(ttl time.Duration) {
+	r.deadlineMu.Lock()
+	defer r.deadlineMu.Unlock()
+	if ttl == 0 {
+		r.deadline = time.Time{}
+		r.acquiredAt = time.Time{}
+		return
+	}
+	r.deadline = time.Now().Add(ttl)
+}
+
+// 加锁成功，记录锁的过期时间与加锁时刻；可重入模式下仍持有锁时的重入沿用首次加锁的时刻
+func (r *RedisLock) setAcquired(expire time.Duration) {
+	r.deadlineMu.Lock()
+	defer r.deadlineMu.Unlock()
+	now := time.Now()
+	if !r.reentrant || r.acquiredAt.IsZero() || !now.Before(r.deadline) {
+		r.acquiredAt = now
+	}
+	r.deadline = now.Add(expire)
+}
+
+// 开启 WithMinHoldTime 时，等待锁自加锁起被持有满 minHoldTime；ctx 结束时放弃等待并返回错误
+func (r *RedisLock) waitMinHoldTime(ctx context.Context) error {
+	if r.minHoldTime <= 0 {
+		return nil
+	}
+	r.deadlineMu.Lock()
+	acquiredAt := r.acquiredAt
+	r.deadlineMu.Unlock()
+	// 未持有锁，由解锁脚本返回 ErrLockNotHeld
+	if acquiredAt.IsZero() {
+		return nil
+	}
+	wait := r.minHoldTime - time.Since(acquiredAt)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("unlock aborted while waiting for min hold time %v: %w", r.minHoldTime, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// 查询锁剩余的过期时间
+// 锁不存在时返回 (0, ErrLockNotHeld)；锁存在但归属于他人时，返回剩余时间及 ErrLockAcquiredByOthers
+// 锁未设置过期时间时返回 -1
+func (r *RedisLock) TTL(ctx context.Context) (time.Duration, error) {
+	pttl, err := r.client.PTTL(ctx, r.getLockKey())
+	if err != nil {
+		return 0, err
+	}
+	// PTTL 返回 -2 代表 key 不存在
+	if pttl == -2 {
+		return 0, ErrLockNotHeld
+	}
+
+	ttl := time.Duration(pttl) * time.Millisecond
+	if pttl == -1 {
+		ttl = -1
+	}
+
+	owned, err := r.IsHeldByMe(ctx)
+	if err != nil {
+		return ttl, err
+	}
+	if !owned {
+		return ttl, ErrLockAcquiredByOthers
+	}
+	return ttl, nil
+}
+
+// 判断当前是否持有锁，适用于长任务在提交副作用前确认锁的归属
+// 锁不存在时返回 (false, nil)
+func (r *RedisLock) IsHeldByMe(ctx context.Context) (bool, error) {
+	// 可重入模式下锁以 hash 存储，无法 GET，基于 lua 脚本判断
+	if r.reentrant {
+		return r.isOwner(ctx)
+	}
+
+	token, err := r.client.Get(ctx, r.getLockKey())
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	token, _ = decodeLockValue(token)
+	return token == r.token, nil
+}
+
+// 查询锁当前持有者的元数据(见 WithMetadata)，持有者可以是其他客户端，适用于排查长时间未释放的锁
+// 锁不存在时返回 ErrLockNotHeld；持有者未附带元数据时返回 nil
+// 可重入锁以 hash 存储，不附带元数据(GET 会返回 WRONGTYPE)，锁存在时总是返回 nil
+func (r *RedisLock) Inspect(ctx context.Context) (map[string]string, error) {
+	if r.reentrant {
+		pttl, err := r.client.PTTL(ctx, r.getLockKey())
+		if err != nil {
+			return nil, err
+		}
+		if pttl == -2 {
+			return nil, ErrLockNotHeld
+		}
+		return nil, nil
+	}
+
+	value, err := r.client.Get(ctx, r.getLockKey())
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrLockNotHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, metadata := decodeLockValue(value)
+	return metadata, nil
+}
+
+// 仅在仍持有锁时写入受锁保护的数据 dataKey，归属权校验与写入在同一个 lua 脚本中原子执行，不再持有锁时返回 ErrLockNotHeld
+// 避免先校验归属权、再单独写入之间锁已丢失；cluster 模式下 dataKey 需与锁的 key 位于同一槽位(借助 hash tag)
+func (r *RedisLock) GuardedSet(ctx context.Context, dataKey, value string) error {
+	if dataKey == "" {
+		return ErrEmptyKey
+	}
+	reply, err := r.client.Eval(ctx, LuaGuardedSet, 2, []interface{}{r.getLockKey(), dataKey, r.token, value})
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not set %s without ownership of lock: %w", dataKey, ErrLockNotHeld)
+	}
+	return nil
+}
+
+// 仅在仍持有锁时读取受锁保护的数据 dataKey，不再持有锁时返回 ErrLockNotHeld，数据不存在时返回 ErrKeyNotFound
+func (r *RedisLock) GuardedGet(ctx context.Context, dataKey string) (string, error) {
+	if dataKey == "" {
+		return "", ErrEmptyKey
+	}
+	reply, err := r.client.Eval(ctx, LuaGuardedGet, 2, []interface{}{r.getLockKey(), dataKey, r.token})
+	if err != nil {
+		return "", err
+	}
+	values, ok := reply.([]interface{})
+	if !ok {
+		return "", fmt.Errorf("can not get %s without ownership of lock: %w", dataKey, ErrLockNotHeld)
+	}
+	if len(values) < 2 {
+		return "", ErrKeyNotFound
+	}
+	return redis.String(values[1], nil)
+}
+
+// 基于 lua 脚本，判断当前 token 是否拥有锁的归属权
+func (r *RedisLock) isOwner(ctx context.Context) (bool, error) {
+	keyAndArgs := []interface{}{r.getLockKey(), r.token}
+	reply, err := r.client.Eval(ctx, LuaCheckOwnership, 1, keyAndArgs)
+	if err != nil {
+		return false, err
+	}
+	ret, _ := reply.(int64)
+	return ret == 1, nil
+}
+
 // 尝试获取锁 (执行 SetNX，查看是否成功)
 func (r *RedisLock) tryLock(ctx context.Context) (err error) {
-	reply, err := r.client.SetNX(ctx, r.getLockKey(), r.token, r.expireSeconds)
-	r.logger.Debug("tryLock: SETNX result, key=%s, reply=%v, err=%v", r.getLockKey(), reply, err)
+	expire, err := r.acquireExpire()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			r.setAcquired(expire)
+		}
+	}()
+
+	if r.reentrant {
+		return r.tryReentrantLock(ctx, expire)
+	}
+	if r.fairQueue {
+		return r.tryFairLock(ctx, expire)
+	}
+	if r.acquireScript != "" {
+		return r.tryLockWithScript(ctx, expire)
+	}
+	if r.ownerDiagnostics {
+		return r.tryLockWithOwner(ctx, expire)
+	}
+
+	var reply int64
+	if r.replicaWait > 0 {
+		return r.tryLockWithReplicationWait(ctx, expire)
+	}
+	if expire%time.Second == 0 {
+		reply, err = r.client.SetNX(ctx, r.getLockKey(), r.lockValue, int64(expire/time.Second))
+	} else {
+		// 非整秒的过期时间，使用毫秒级的 PX
+		reply, err = r.client.SetNXPX(ctx, r.getLockKey(), r.lockValue, expire.Milliseconds())
+	}
+	r.log(ctx).Debug("tryLock: SETNX 结果", "key", r.getLockKey(), "reply", reply, "err", err)
+
+	// 关键！！ 发生 redis 返回为空错误时，不能直接返回错误，要将其作为 ErrLockAcquiredByOthers 错误返回(可重试)
+	if errors.Is(err, redis.ErrNil) {
+		r.metrics.OnContention()
+		return fmt.Errorf("lock %s is held by others: %w", r.getLockKey(), ErrLockAcquiredByOthers)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 尝试获取锁，加锁成功后通过 WAIT 等待锁复制到足够的从节点，确认数不足时释放锁并返回 ErrReplicationTimeout
+func (r *RedisLock) tryLockWithReplicationWait(ctx context.Context, expire time.Duration) error {
+	client, ok := r.client.(ReplicationClient)
+	if !ok {
+		return errors.New("client does not support replication wait")
+	}
 
-	// TODO 关键！！ 发生 redis 返回为空错误时，不能直接返回错误，要将其作为 ErrLockAcquiredByOthers 错误返回
+	reply, acked, err := client.SetNXPXWait(ctx, r.getLockKey(), r.lockValue, expire.Milliseconds(), r.replicaWait, r.replicaWaitTimeout)
+	r.log(ctx).Debug("tryLock: SETNX + WAIT 结果", "key", r.getLockKey(), "acked", acked, "err", err)
 	if errors.Is(err, redis.ErrNil) {
-		r.logger.Debug("redis.ErrNil 代表执行 redis SETNX 失败，未获取到锁，可重试: reply: %d, err: %v", reply, ErrLockAcquiredByOthers)
-		return fmt.Errorf("redis.ErrNil 代表执行 redis SETNX 失败，未获取到锁，可重试: reply: %d, err: %w", reply, ErrLockAcquiredByOthers)
+		r.metrics.OnContention()
+		return fmt.Errorf("lock %s is held by others: %w", r.getLockKey(), ErrLockAcquiredByOthers)
+	}
+	if err != nil {
+		// SET NX 成功而 WAIT 失败(超时、连接断开、WAIT 被禁用)，调用方会视为加锁失败，需释放已写入的锁
+		if reply == 1 {
+			r.releaseUnreplicated(ctx)
+		}
+		return err
+	}
+
+	if acked < int64(r.replicaWait) {
+		// 锁可能在主从切换后丢失，不能视为加锁成功，尽力释放已写入主节点的锁
+		r.releaseUnreplicated(ctx)
+		return fmt.Errorf("%w: %d of %d replicas acknowledged within %v", ErrReplicationTimeout, acked, r.replicaWait, r.replicaWaitTimeout)
+	}
+	return nil
+}
+
+// 尽力释放未确认复制的锁，释放失败只记录日志，锁在过期后自动释放
+func (r *RedisLock) releaseUnreplicated(ctx context.Context) {
+	if _, err := r.client.Eval(ctx, LuaCheckAndDeleteDistributionLock, 1, []interface{}{r.getLockKey(), r.token}); err != nil {
+		r.log(ctx).Error("复制确认失败，释放锁失败", "key", r.getLockKey(), "err", err)
+	}
+}
+
+// 可重入模式下尝试获取锁 (基于 lua 脚本，锁不存在或归属于当前 token 时，重入次数 +1)
+func (r *RedisLock) tryReentrantLock(ctx context.Context, expire time.Duration) error {
+	reply, err := r.client.Eval(ctx, LuaReentrantLock, 1, lockScriptArgs(r.getLockKey(), r.token, expire.Milliseconds()))
+	if err != nil {
+		return err
 	}
 
+	if ret, _ := reply.(int64); ret != 1 {
+		r.metrics.OnContention()
+		return ErrLockAcquiredByOthers
+	}
+	return nil
+}
+
+// 基于自定义加锁脚本尝试加锁
+func (r *RedisLock) tryLockWithScript(ctx context.Context, expire time.Duration) error {
+	reply, err := r.client.Eval(ctx, r.acquireScript, 1, lockScriptArgs(r.getLockKey(), r.token, expire.Milliseconds()))
 	if err != nil {
 		return err
 	}
 
+	if ret, _ := reply.(int64); ret != 1 {
+		r.metrics.OnContention()
+		return fmt.Errorf("lock %s is held by others: %w", r.getLockKey(), ErrLockAcquiredByOthers)
+	}
 	return nil
 }
 
+// 本次取锁使用的过期时间：WithExpireAt 模式下为距离过期时刻的剩余时间(毫秒精度)，过期时刻已过时返回 ErrExpireAtPassed
+func (r *RedisLock) acquireExpire() (time.Duration, error) {
+	if r.expireAt.IsZero() {
+		return r.expireDuration, nil
+	}
+	expire := time.Until(r.expireAt).Truncate(time.Millisecond)
+	if expire <= 0 {
+		return 0, fmt.Errorf("%w: %v", ErrExpireAtPassed, r.expireAt)
+	}
+	return expire, nil
+}
+
+// 尝试获取锁，失败时返回包含当前持有者的 *LockHeldError (基于 lua 脚本)
+func (r *RedisLock) tryLockWithOwner(ctx context.Context, expire time.Duration) error {
+	reply, err := r.client.Eval(ctx, LuaAcquireReturnOwner, 1, lockScriptArgs(r.getLockKey(), r.lockValue, expire.Milliseconds()))
+	if err != nil {
+		return err
+	}
+
+	// 不同的客户端对 bulk string 的返回类型不同(redigo 为 []byte，go-redis 为 string)
+	switch v := reply.(type) {
+	case int64:
+		if v == 1 {
+			return nil
+		}
+		// 锁在 SET NX 与 GET 之间恰好过期，持有者未知，可重试
+		r.metrics.OnContention()
+		return fmt.Errorf("lock %s is held by others: %w", r.getLockKey(), ErrLockAcquiredByOthers)
+	case []byte:
+		r.metrics.OnContention()
+		owner, _ := decodeLockValue(string(v))
+		return &LockHeldError{Key: r.getLockKey(), Owner: owner}
+	case string:
+		r.metrics.OnContention()
+		owner, _ := decodeLockValue(v)
+		return &LockHeldError{Key: r.getLockKey(), Owner: owner}
+	}
+	return fmt.Errorf("unexpected acquire reply: %v", reply)
+}
+
+// 公平锁模式下尝试获取锁 (基于 lua 脚本，排队并在位于队首时加锁)
+func (r *RedisLock) tryFairLock(ctx context.Context, expire time.Duration) error {
+	keyAndArgs := []interface{}{r.getLockKey(), r.getQueueKey(), r.token, luaInt(expire.Milliseconds()), luaInt(r.maxQueueWait().Milliseconds()), r.lockValue}
+	reply, err := r.client.Eval(ctx, LuaFairLock, 2, keyAndArgs)
+	if err != nil {
+		return err
+	}
+
+	if ret, _ := reply.(int64); ret != 1 {
+		r.metrics.OnContention()
+		return fmt.Errorf("lock %s is held by others or not at the queue head: %w", r.getLockKey(), ErrLockAcquiredByOthers)
+	}
+	return nil
+}
+
+// 等锁方在队列中的最长停留时间，超过后视为已崩溃被清理出队
+// 取阻塞等锁时间与取锁超时时间中的较大者，并多留一个轮询间隔的余量
+func (r *RedisLock) maxQueueWait() time.Duration {
+	wait := time.Duration(r.blockWaitingSeconds) * time.Second
+	if r.acquireTimeout > wait {
+		wait = r.acquireTimeout
+	}
+	if wait <= 0 {
+		wait = r.expireDuration
+	}
+	return wait + r.pollInterval
+}
+
+// 公平锁模式下放弃等锁，将 token 移出等锁队列
+// 调用方 ctx 此时可能已取消，出队使用独立的 ctx，保证出队，避免阻塞后续的等锁方；ctx 仅用于日志
+func (r *RedisLock) leaveQueue(ctx context.Context) {
+	if !r.fairQueue || r.reentrant {
+		return
+	}
+	if _, err := r.client.Eval(context.Background(), LuaLeaveQueue, 1, []interface{}{r.getQueueKey(), r.token}); err != nil {
+		r.log(ctx).Error("退出等锁队列失败", "queue", r.getQueueKey(), "err", err)
+	}
+}
+
+// 本次操作的日志组件，开启 WithLogContextFields 时每条日志附带从 ctx 中提取的字段
+func (r *RedisLock) log(ctx context.Context) Logger {
+	if r.logContextFields == nil || ctx == nil {
+		return r.logger
+	}
+	fields := r.logContextFields(ctx)
+	if len(fields) == 0 {
+		return r.logger
+	}
+	return fieldsLogger{Logger: r.logger, fields: fields}
+}
+
 func (r *RedisLock) getLockKey() string {
-	return RedisLockKeyPrefix + r.key
+	return r.keyPrefix + r.key
+}
+
+// 开启 WithMetadata 时锁的值的格式
+type lockPayload struct {
+	Token    string            `json:"token"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// 编码锁的值，未附带元数据时即为 token
+func encodeLockValue(token string, metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return token
+	}
+	b, _ := json.Marshal(lockPayload{Token: token, Metadata: metadata})
+	return string(b)
+}
+
+// 从锁的值中解析出 token 与元数据，与 lua 脚本中的 tokenOf 保持一致：无法解析为锁的值格式的 JSON 时，值即为 token
+func decodeLockValue(value string) (string, map[string]string) {
+	if !strings.HasPrefix(value, "{") {
+		return value, nil
+	}
+	var v lockPayload
+	if err := json.Unmarshal([]byte(value), &v); err != nil || v.Token == "" {
+		return value, nil
+	}
+	return v.Token, v.Metadata
+}
+
+// 公平锁模式下的等锁队列，与锁在同一个脚本中操作，附带锁 key 的 hash tag 保证 cluster 模式下两者位于同一槽位
+func (r *RedisLock) getQueueKey() string {
+	return sameSlotKey(r.getDerivedKey(RedisLockQueuePrefix), r.getLockKey())
+}
+
+// 等锁计数的 key
+func (r *RedisLock) getWaitersKey() string {
+	return r.getDerivedKey(RedisLockWaitersPrefix)
+}
+
+// 由锁的 key 派生的辅助 key：默认前缀下沿用固定前缀 kind + key，
+// WithKeyPrefix 指定了前缀时再以该前缀为命名空间，避免不同服务的等锁队列、等锁计数相互冲突
+func (r *RedisLock) getDerivedKey(kind string) string {
+	if r.keyPrefix == RedisLockKeyPrefix {
+		return kind + r.key
+	}
+	return r.keyPrefix + kind + r.key
+}
+
+// 解锁通知的 channel
+func (r *RedisLock) getNotifyChannel() string {
+	return r.notifyChannel(r.key)
+}
+
+// 订阅解锁通知，客户端不支持 pub/sub 时返回 nil 通道(select 时永远阻塞，即退化为轮询)
+func (r *RedisLock) subscribeUnlock(ctx context.Context) (<-chan struct{}, func()) {
+	client, ok := r.client.(NotifyClient)
+	if !r.notifyWait || !ok {
+		return nil, func() {}
+	}
+
+	notifyCh, cancel, err := client.Subscribe(ctx, r.getNotifyChannel())
+	if err != nil {
+		r.log(ctx).Error("订阅解锁通知失败，退化为轮询取锁", "channel", r.getNotifyChannel(), "err", err)
+		return nil, func() {}
+	}
+	return notifyCh, cancel
+}
+
+// 锁释放后发布解锁通知，通知失败不影响解锁结果
+func (r *RedisLock) publishUnlock(ctx context.Context) {
+	if !r.notifyWait {
+		return
+	}
+	if _, err := r.client.Eval(ctx, LuaPublishUnlockNotify, 0, []interface{}{r.getNotifyChannel()}); err != nil {
+		r.log(ctx).Error("发布解锁通知失败", "channel", r.getNotifyChannel(), "err", err)
+	}
+}
+
+// 开启 WithContentionTracking 时登记为等锁方，返回注销登记的函数；计数失败只记录日志，不影响取锁
+func (r *RedisLock) enterWaiters(ctx context.Context) func() {
+	if !r.contentionTracking {
+		return func() {}
+	}
+
+	// 计数的过期时间覆盖阻塞等锁的最长时间
+	ttl := time.Duration(r.blockWaitingSeconds)*time.Second + r.pollInterval
+	if _, err := r.client.Eval(ctx, LuaWaiterEnter, 1, []interface{}{r.getWaitersKey(), luaInt(ttl.Milliseconds())}); err != nil {
+		r.log(ctx).Error("登记等锁方失败", "key", r.getWaitersKey(), "err", err)
+		return func() {}
+	}
+	return func() {
+		// 调用方 ctx 此时可能已取消，使用独立的 ctx，保证注销登记
+		if _, err := r.client.Eval(context.Background(), LuaWaiterLeave, 1, []interface{}{r.getWaitersKey()}); err != nil {
+			r.log(ctx).Error("注销等锁方失败", "key", r.getWaitersKey(), "err", err)
+		}
+	}
+}
+
+// 查询当前阻塞等待该锁的等锁方数量，用于观测锁的竞争程度(如作为扩缩容的参考)，只统计开启了 WithContentionTracking 的等锁方
+// 该值是近似的：未能正常退出(如进程崩溃)的等锁方在计数过期(最长阻塞等锁时间)前仍被计入
+func (r *RedisLock) Contention(ctx context.Context) (int64, error) {
+	value, err := r.client.Get(ctx, r.getWaitersKey())
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid waiter count %q: %w", value, err)
+	}
+	if count < 0 {
+		count = 0
+	}
+	return count, nil
 }
 
-// 阻塞模式，持续轮询去获取锁
-func (r *RedisLock) blockingLock(ctx context.Context) error {
+// 阻塞模式，持续轮询去获取锁，每次取锁累计到 result.Attempts；firstErr 为首次取锁失败的错误
+// 等锁超时、重试次数用尽时，若最近一次取锁返回了 *LockHeldError(WithOwnerDiagnostics)，返回的错误中保留该持有者
+func (r *RedisLock) blockingLock(ctx context.Context, tryLock func(ctx context.Context) error, result *LockResult, firstErr error) error {
+	// 最近一次取锁失败的原因，默认为 ErrLockAcquiredByOthers
+	var lastErr error = ErrLockAcquiredByOthers
+	var heldErr *LockHeldError
+	if errors.As(firstErr, &heldErr) {
+		lastErr = heldErr
+	}
+
 	// 阻塞模式等锁时间上限
 	timeoutCh := time.After(time.Duration(r.blockWaitingSeconds) * time.Second)
-	// 轮询 ticker，每隔 50 ms 尝试取锁一次
-	ticker := time.NewTicker(time.Duration(50) * time.Millisecond)
-	defer ticker.Stop()
+	// 轮询 timer，每隔 pollInterval(加随机抖动) 尝试取锁一次
+	timer := time.NewTimer(r.nextPollInterval(0))
+	defer timer.Stop()
+	// 解锁通知模式下订阅解锁通知，收到通知立即取锁，轮询作为兜底
+	notifyCh, cancel := r.subscribeUnlock(ctx)
+	defer cancel()
+	// 登记为等锁方，退出阻塞等锁(取锁成功或放弃)时注销
+	leave := r.enterWaiters(ctx)
+	defer leave()
 
-	for range ticker.C {
+	for retries := 1; ; retries++ {
 		select {
 		// ctx 终止了
 		case <-ctx.Done():
 			return fmt.Errorf("lock failed, ctx timeout, err: %w", ctx.Err())
-			// 阻塞等锁达到上限时间
+		// 阻塞等锁达到上限时间
 		case <-timeoutCh:
-			return fmt.Errorf("block waiting time out, err: %w", ErrLockAcquiredByOthers)
+			return fmt.Errorf("block waiting time out, err: %w", lastErr)
 		// 放行
-		default:
+		case <-timer.C:
+		// 收到解锁通知，不等 timer 到期立即取锁
+		case _, ok := <-notifyCh:
+			if !ok {
+				// 订阅连接断开，退化为轮询
+				notifyCh = nil
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
 		}
 
 		// 尝试取锁
-		err := r.tryLock(ctx)
+		result.Attempts++
+		err := tryLock(ctx)
 		if err == nil {
 			// 加锁成功，返回结果
 			return nil
@@ -198,30 +1197,136 @@ func (r *RedisLock) blockingLock(ctx context.Context) error {
 		if !IsRetryableErr(err) {
 			return err
 		}
-	}
 
-	// 不可达
-	return nil
+		lastErr = ErrLockAcquiredByOthers
+		if errors.As(err, &heldErr) {
+			lastErr = heldErr
+		}
+
+		// 重试次数用尽
+		if r.maxRetries > 0 && retries >= r.maxRetries {
+			return fmt.Errorf("max retries %d exceeded, err: %w", r.maxRetries, lastErr)
+		}
+
+		timer.Reset(r.nextPollInterval(retries))
+	}
 }
 
 // 解锁，基于 lua 脚本，实现身份验证与解锁的原子化操作
-func (r *RedisLock) Unlock(ctx context.Context) error {
+func (r *RedisLock) Unlock(ctx context.Context) (err error) {
 	defer func() {
-		// TODO: 停止 watch dog
-		r.logger.Info("解锁，看门狗关闭")
-		r.stopDog()
+		r.metrics.OnUnlock(err == nil)
 	}()
 
-	keyAndArgs := []interface{}{r.getLockKey(), r.token}
-	reply, err := r.client.Eval(ctx, LuaCheckAndDeleteDistributionLock, 1, keyAndArgs)
+	// 在临界区外等待最短持有时间，等待期间不阻塞其他协程的 Lock/Extend
+	if err = r.waitMinHoldTime(ctx); err != nil {
+		return err
+	}
+
+	// 解锁与关闭看门狗在同一临界区内完成，期间其他协程加锁成功后启动看门狗需等待
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reentrant {
+		return r.reentrantUnlock(ctx)
+	}
+
+	// 先停止看门狗再删除锁，避免删除后看门狗仍在续约、上报续约失败
+	// 续约脚本会校验归属权，即使有正在进行的续约，也不会在锁被删除后重新设置过期时间
+	r.stopWatchDogLocked()
+
+	released, err := r.release(ctx)
 	if err != nil {
 		return err
 	}
+	if !released {
+		r.setDeadline(0)
+		return fmt.Errorf("can not unlock without ownership of lock: %w", ErrLockNotHeld)
+	}
 
+	r.setDeadline(0)
+	r.publishUnlock(ctx)
+	return nil
+}
+
+// 删除锁，返回锁是否由当前 token 持有并被删除
+func (r *RedisLock) release(ctx context.Context) (bool, error) {
+	if r.nonAtomicUnlock {
+		return r.releaseNonAtomic(ctx)
+	}
+
+	script := LuaCheckAndDeleteDistributionLock
+	if r.releaseScript != "" {
+		script = r.releaseScript
+	}
+	keyAndArgs := []interface{}{r.getLockKey(), r.token}
+	reply, err := r.client.Eval(ctx, script, 1, keyAndArgs)
+	if err != nil {
+		return false, err
+	}
 	// 判断解锁是否成功(执行 DEL 操作成功，返回 1)
-	if ret, _ := reply.(int64); ret != 1 {
-		return errors.New("can not unlock without ownership of lock")
+	ret, _ := reply.(int64)
+	return ret == 1, nil
+}
+
+// 不依赖 lua 的解锁：GET 比较 token 后 DEL
+// 两步之间锁可能恰好过期并被他人获取，此时会误删他人的锁，仅用于禁用了脚本的 redis
+func (r *RedisLock) releaseNonAtomic(ctx context.Context) (bool, error) {
+	value, err := r.client.Get(ctx, r.getLockKey())
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	if token, _ := decodeLockValue(value); token != r.token {
+		return false, nil
+	}
+	if err = r.client.Del(ctx, r.getLockKey()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
+// 可重入模式下解锁，重入次数归零时才真正删除锁并关闭看门狗，调用方需持有 r.mu
+func (r *RedisLock) reentrantUnlock(ctx context.Context) error {
+	keyAndArgs := []interface{}{r.getLockKey(), r.token}
+	reply, err := r.client.Eval(ctx, LuaReentrantUnlock, 1, keyAndArgs)
+	if err != nil {
+		// 请求失败时服务端的重入次数可能仍大于 0，看门狗继续续约，避免外层持有者的锁过期
+		return err
+	}
+
+	ret, _ := reply.(int64)
+	// 仍有剩余重入次数，锁未释放，看门狗继续续约
+	if ret > 0 {
+		return nil
+	}
+
+	r.stopWatchDogLocked()
+	if ret < 0 {
+		r.setDeadline(0)
+		return fmt.Errorf("can not unlock without ownership of lock: %w", ErrLockNotHeld)
+	}
+	r.setDeadline(0)
+	r.publishUnlock(ctx)
 	return nil
 }
+
+// 停止看门狗
+// 非看门狗模式、加锁失败、或重复解锁时 stopDog 可能为空，需判空，保证 Unlock 可以被重复调用
+func (r *RedisLock) stopWatchDog() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopWatchDogLocked()
+}
+
+// 停止看门狗，调用方需持有 r.mu
+func (r *RedisLock) stopWatchDogLocked() {
+	if r.stopDog == nil {
+		return
+	}
+	r.logger.Info("解锁，看门狗关闭", "key", r.getLockKey())
+	r.stopDog()
+	r.stopDog = nil
+}
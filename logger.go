@@ -1,49 +1,121 @@
 package redislock
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 )
 
+// Logger 分布式锁的日志接口，可通过 WithLogger 等选项注入，将日志接入业务自身的 zap/logrus/slog 等日志组件
+// 统一采用结构化日志：msg 为日志内容，keysAndValues 为交替出现的 key、value，如 Info("看门狗启动", "key", key)
+// 与 slog.Logger、zap.SugaredLogger 的 Infow 等方法的参数约定一致
+type Logger interface {
+	Debug(msg string, keysAndValues ...any)
+	Info(msg string, keysAndValues ...any)
+	Error(msg string, keysAndValues ...any)
+}
+
 type logger interface {
 	Printf(format string, v ...any)
 	Println(v ...any)
 }
 
+// 日志级别，低于该级别的日志不会输出
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelError
+)
+
 type logx struct {
+	level  LogLevel
 	infoL  logger
 	errorL logger
 	debugL logger
 }
 
-func newLogger() *logx {
-	Info := log.New(os.Stdout, "[Info]: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Error := log.New(os.Stdout, "[Error]: ", log.Ldate|log.Ltime|log.Lshortfile)
-	Debug := log.New(os.Stdout, "[Debug]: ", log.Ldate|log.Ltime|log.Lshortfile)
+// 默认日志组件，输出 Info 及以上级别的日志
+func newLogger() Logger {
+	return NewDefaultLogger(LevelInfo)
+}
+
+// 创建输出到标准输出的默认日志组件，只输出 level 及以上级别的日志
+// 例如 WithLogger(NewDefaultLogger(LevelDebug)) 可开启看门狗每次续约等调试日志
+func NewDefaultLogger(level LogLevel) Logger {
+	return newWriterLogger(os.Stdout, level, log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// 创建输出到 w 的默认日志组件，日志格式为 "[级别]: 时间 msg key1=value1 key2=value2"
+func newWriterLogger(w io.Writer, level LogLevel, flag int) *logx {
+	Info := log.New(w, "[Info]: ", flag)
+	Error := log.New(w, "[Error]: ", flag)
+	Debug := log.New(w, "[Debug]: ", flag)
+
+	return &logx{level: level, infoL: Info, errorL: Error, debugL: Debug}
+}
+
+func (l *logx) Info(msg string, keysAndValues ...any) {
+	if l.level > LevelInfo {
+		return
+	}
+	l.infoL.Println(formatLog(msg, keysAndValues))
+}
+
+func (l *logx) Error(msg string, keysAndValues ...any) {
+	if l.level > LevelError {
+		return
+	}
+	l.errorL.Println(formatLog(msg, keysAndValues))
+}
 
-	return &logx{infoL: Info, errorL: Error, debugL: Debug}
+func (l *logx) Debug(msg string, keysAndValues ...any) {
+	if l.level > LevelDebug {
+		return
+	}
+	l.debugL.Println(formatLog(msg, keysAndValues))
 }
 
-func (l *logx) Info(v ...any) {
-	l.infoL.Println(v...)
+// 在每条日志的 key/value 之后追加固定字段的日志组件
+type fieldsLogger struct {
+	Logger
+	fields []any
 }
 
-func (l *logx) Infof(format string, v ...any) {
-	l.infoL.Printf(format, v...)
+func (l fieldsLogger) Debug(msg string, keysAndValues ...any) {
+	l.Logger.Debug(msg, l.with(keysAndValues)...)
 }
 
-func (l *logx) Error(v ...any) {
-	l.errorL.Println(v...)
+func (l fieldsLogger) Info(msg string, keysAndValues ...any) {
+	l.Logger.Info(msg, l.with(keysAndValues)...)
 }
 
-func (l *logx) Errorf(format string, v ...any) {
-	l.errorL.Printf(format, v...)
+func (l fieldsLogger) Error(msg string, keysAndValues ...any) {
+	l.Logger.Error(msg, l.with(keysAndValues)...)
 }
 
-func (l *logx) Debug(v ...any) {
-	l.debugL.Println(v...)
+func (l fieldsLogger) with(keysAndValues []any) []any {
+	kvs := make([]any, 0, len(keysAndValues)+len(l.fields))
+	kvs = append(kvs, keysAndValues...)
+	return append(kvs, l.fields...)
 }
 
-func (l *logx) Debugf(format string, v ...any) {
-	l.debugL.Printf(format, v...)
+// 将 msg 与 key/value 拼接为 "msg key1=value1 key2=value2"，缺少 value 的 key 输出为 key=<missing>
+func formatLog(msg string, keysAndValues []any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		b.WriteByte(' ')
+		fmt.Fprint(&b, keysAndValues[i])
+		b.WriteByte('=')
+		if i+1 < len(keysAndValues) {
+			fmt.Fprint(&b, keysAndValues[i+1])
+		} else {
+			b.WriteString("<missing>")
+		}
+	}
+	return b.String()
 }
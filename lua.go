@@ -1,13 +1,27 @@
 package redislock
 
+// luaTokenOf 从锁的值中取出 token：开启 WithMetadata 时锁的值为 {"token":...,"metadata":{...}} 格式的 JSON，其余情况锁的值即为 token
+// 归属权校验只比较 token 部分，元数据不影响归属权
+const luaTokenOf = `
+  local function tokenOf(value)
+    if (value and string.sub(value,1,1) == '{') then
+      local ok, decoded = pcall(cjson.decode,value)
+      if (ok and type(decoded) == 'table' and decoded.token) then
+        return decoded.token
+      end
+    end
+    return value
+  end
+`
+
 // LuaCheckAndDeleteDistributionLock 判断是否拥有分布式锁的归属权，是则删除
 // KEYS[1]: Redis EVAL 命令传入的第一个键参数
 // ARGV[1]: Redis EVAL 命令传入的第一个非键参数
 // redis.call('get',lockerKey): lua 执行 redis 命令的方式
-const LuaCheckAndDeleteDistributionLock = `
+const LuaCheckAndDeleteDistributionLock = luaTokenOf + `
   local lockerKey = KEYS[1]
   local targetToken = ARGV[1]
-  local getToken = redis.call('get',lockerKey) 
+  local getToken = tokenOf(redis.call('get',lockerKey))
   if (not getToken or getToken ~= targetToken) then 
 	return 0
 	else
@@ -15,15 +29,351 @@ const LuaCheckAndDeleteDistributionLock = `
   end
 `
 
-// LuaCheckAndExpireDistributionLock 判断是否拥有分布式锁的归属权，是则续期
-const LuaCheckAndExpireDistributionLock = `
-  local lockerKey = KEYS[1] 
+// LuaCheckAndExpireDistributionLock 判断是否拥有分布式锁的归属权，是则续期，返回续期后的剩余过期时间(毫秒)，否则返回 0
+// ARGV[2]: 续期时长(秒)，以 tonumber 转换，避免以字符串形式传入 expire；非正数(expire 0 会删除 key)视为续期失败
+const LuaCheckAndExpireDistributionLock = luaTokenOf + `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  local getToken = tokenOf(redis.call('get',lockerKey))
+  if (not getToken or getToken ~= targetToken or not duration or duration <= 0) then
+    return 0
+  end
+  if (redis.call('expire',lockerKey,duration) ~= 1) then
+    return 0
+  end
+  return redis.call('pttl',lockerKey)
+`
+
+// LuaCheckAndPExpireDistributionLock 判断是否拥有分布式锁的归属权，是则以毫秒为单位续期，返回续期后的剩余过期时间(毫秒)，否则返回 0
+const LuaCheckAndPExpireDistributionLock = luaTokenOf + `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  local getToken = tokenOf(redis.call('get',lockerKey))
+  if (not getToken or getToken ~= targetToken or not duration or duration <= 0) then
+    return 0
+  end
+  if (redis.call('pexpire',lockerKey,duration) ~= 1) then
+    return 0
+  end
+  return redis.call('pttl',lockerKey)
+`
+
+// LuaReentrantLock 可重入加锁：锁以 hash 存储 token -> 重入次数
+// 锁不存在，或锁归属于当前 token 时，重入次数 +1 并刷新过期时间(毫秒)，返回 1；否则返回 0
+const LuaReentrantLock = `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  if (redis.call('exists',lockerKey) == 0 or redis.call('hexists',lockerKey,targetToken) == 1) then
+    redis.call('hincrby',lockerKey,targetToken,1)
+    redis.call('pexpire',lockerKey,duration)
+    return 1
+  end
+  return 0
+`
+
+// LuaReentrantUnlock 可重入解锁：判断是否拥有锁的归属权，是则重入次数 -1，次数归零时删除锁
+// 返回 -1：不持有锁；返回值 >= 0：剩余的重入次数
+const LuaReentrantUnlock = `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  if (redis.call('hexists',lockerKey,targetToken) == 0) then
+    return -1
+  end
+  local count = redis.call('hincrby',lockerKey,targetToken,-1)
+  if (count <= 0) then
+    redis.call('del',lockerKey)
+    return 0
+  end
+  return count
+`
+
+// LuaReentrantExpire 可重入锁续期：判断是否拥有锁的归属权(重入次数 > 0)，是则续期(毫秒)，返回续期后的剩余过期时间(毫秒)，否则返回 0
+// ARGV[2]: 续期时长(毫秒)，非正数视为续期失败
+const LuaReentrantExpire = `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  local count = tonumber(redis.call('hget',lockerKey,targetToken))
+  if (not count or count <= 0 or not duration or duration <= 0) then
+    return 0
+  end
+  if (redis.call('pexpire',lockerKey,duration) ~= 1) then
+    return 0
+  end
+  return redis.call('pttl',lockerKey)
+`
+
+// LuaCheckOwnership 判断当前 token 是否拥有分布式锁的归属权(兼容普通锁与可重入锁)，是则返回 1，否则返回 0
+const LuaCheckOwnership = luaTokenOf + `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local keyType = redis.call('type',lockerKey)['ok']
+  if (keyType == 'hash') then
+    return redis.call('hexists',lockerKey,targetToken)
+  end
+  if (keyType == 'string' and tokenOf(redis.call('get',lockerKey)) == targetToken) then
+    return 1
+  end
+  return 0
+`
+
+// LuaPublishUnlockNotify 解锁后向 channel 发布解锁通知，唤醒订阅该 channel 的等锁方
+// ARGV[1]: 通知的 channel
+const LuaPublishUnlockNotify = `
+  return redis.call('publish',ARGV[1],'unlock')
+`
+
+// LuaRWReadLock 读锁加锁：写锁不存在，或写锁归属于当前 token(持有写锁时可降级加读锁)时，读锁 hash 中当前 token 的重入次数 +1
+// KEYS[1]: 写锁 key；KEYS[2]: 读锁 key，以 hash 存储 token -> 重入次数；ARGV[2]: 过期时间(毫秒)
+// 加锁成功返回 1，否则返回 0
+const LuaRWReadLock = `
+  local writeKey = KEYS[1]
+  local readKey = KEYS[2]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  local writer = redis.call('get',writeKey)
+  if (writer and writer ~= targetToken) then
+    return 0
+  end
+  redis.call('hincrby',readKey,targetToken,1)
+  redis.call('pexpire',readKey,duration)
+  return 1
+`
+
+// LuaRWReadUnlock 读锁解锁：当前 token 的重入次数 -1，归零时移除该 token，所有读者都释放后删除读锁
+// 返回 -1：不持有读锁；返回值 >= 0：当前 token 剩余的重入次数
+const LuaRWReadUnlock = `
+  local readKey = KEYS[1]
+  local targetToken = ARGV[1]
+  if (redis.call('hexists',readKey,targetToken) == 0) then
+    return -1
+  end
+  local count = redis.call('hincrby',readKey,targetToken,-1)
+  if (count > 0) then
+    return count
+  end
+  redis.call('hdel',readKey,targetToken)
+  if (redis.call('hlen',readKey) == 0) then
+    redis.call('del',readKey)
+  end
+  return 0
+`
+
+// LuaRWWriteLock 写锁加锁：不存在任何读者，且写锁不存在时，设置写锁
+// KEYS[1]: 写锁 key；KEYS[2]: 读锁 key；ARGV[2]: 过期时间(毫秒)
+// 加锁成功返回 1，否则返回 0
+const LuaRWWriteLock = `
+  local writeKey = KEYS[1]
+  local readKey = KEYS[2]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  if (redis.call('exists',readKey) == 1 or redis.call('exists',writeKey) == 1) then
+    return 0
+  end
+  redis.call('set',writeKey,targetToken,'px',duration)
+  return 1
+`
+
+// LuaSemaphoreAcquire 信号量加锁：以 sorted set 存储 token -> 过期时间戳(毫秒，取 redis 服务端时间)
+// 先清理已过期的持有者，token 已是持有者时刷新过期时间，持有者数量小于 limit 时加入
+// ARGV[1]: token；ARGV[2]: limit；ARGV[3]: 过期时间(毫秒)
+// 加锁成功返回 1，否则返回 0
+const LuaSemaphoreAcquire = `
+  local semKey = KEYS[1]
   local targetToken = ARGV[1]
-  local duration = ARGV[2]
-  local getToken = redis.call('get',lockerKey)
+  local limit = tonumber(ARGV[2])
+  local duration = tonumber(ARGV[3])
+  local t = redis.call('time')
+  local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+  redis.call('zremrangebyscore',semKey,'-inf',now)
+  if (not redis.call('zscore',semKey,targetToken) and redis.call('zcard',semKey) >= limit) then
+    return 0
+  end
+  redis.call('zadd',semKey,now + duration,targetToken)
+  if (redis.call('pttl',semKey) < duration) then
+    redis.call('pexpire',semKey,duration)
+  end
+  return 1
+`
+
+// LuaSemaphoreRefresh 信号量续期：token 仍是未过期的持有者时刷新其过期时间，返回 1，否则返回 0
+const LuaSemaphoreRefresh = `
+  local semKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  local t = redis.call('time')
+  local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+  local score = tonumber(redis.call('zscore',semKey,targetToken))
+  if (not score or score <= now) then
+    return 0
+  end
+  redis.call('zadd',semKey,now + duration,targetToken)
+  if (redis.call('pttl',semKey) < duration) then
+    redis.call('pexpire',semKey,duration)
+  end
+  return 1
+`
+
+// LuaSemaphoreRelease 信号量解锁：移除 token，返回移除的数量(0 代表不是持有者)
+const LuaSemaphoreRelease = `
+  return redis.call('zrem',KEYS[1],ARGV[1])
+`
+
+// LuaFairLock 公平锁加锁：等锁队列以 sorted set 存储 token -> 入队时间戳(毫秒，取 redis 服务端时间)，按入队先后排序
+// 先清理入队时间超过最长等锁时间的等锁方(已崩溃)，token 不在队列中时入队；token 位于队首且锁不存在时加锁并出队
+// KEYS[1]: 锁 key；KEYS[2]: 等锁队列 key；ARGV[2]: 过期时间(毫秒)；ARGV[3]: 最长等锁时间(毫秒)；ARGV[4]: 锁的值，缺省时为 token
+// 加锁成功返回 1，否则返回 0
+const LuaFairLock = `
+  local lockerKey = KEYS[1]
+  local queueKey = KEYS[2]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  local maxWait = tonumber(ARGV[3])
+  local t = redis.call('time')
+  local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+  redis.call('zremrangebyscore',queueKey,'-inf',now - maxWait)
+  if (not redis.call('zscore',queueKey,targetToken)) then
+    redis.call('zadd',queueKey,now,targetToken)
+  end
+  local head = redis.call('zrange',queueKey,0,0)[1]
+  if (head == targetToken and redis.call('exists',lockerKey) == 0) then
+    redis.call('set',lockerKey,ARGV[4] or targetToken,'px',duration)
+    redis.call('zrem',queueKey,targetToken)
+    return 1
+  end
+  redis.call('pexpire',queueKey,maxWait)
+  return 0
+`
+
+// LuaLeaveQueue 公平锁模式下将 token 移出等锁队列
+const LuaLeaveQueue = `
+  return redis.call('zrem',KEYS[1],ARGV[1])
+`
+
+// LuaAcquireReturnOwner 加锁：SET NX PX 成功返回 1；失败时返回当前持有者的锁的值，锁恰好过期时返回 0
+// ARGV[1]: 锁的值(token，开启 WithMetadata 时为包含 token 与元数据的 JSON)；ARGV[2]: 过期时间(毫秒)
+const LuaAcquireReturnOwner = `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  if (redis.call('set',lockerKey,targetToken,'px',duration,'nx')) then
+    return 1
+  end
+  local owner = redis.call('get',lockerKey)
+  if (not owner) then
+    return 0
+  end
+  return owner
+`
+
+// LuaMultiLock 多 key 原子加锁：所有 key 都不存在时，以同一 token 设置全部 key，返回 1；任一 key 已存在时不做任何修改，返回 0
+// ARGV[1]: 锁的值；ARGV[2]: 过期时间(毫秒)
+const LuaMultiLock = `
+  local targetToken = ARGV[1]
+  local duration = tonumber(ARGV[2])
+  for _, lockerKey in ipairs(KEYS) do
+    if (redis.call('exists',lockerKey) == 1) then
+      return 0
+    end
+  end
+  for _, lockerKey in ipairs(KEYS) do
+    redis.call('set',lockerKey,targetToken,'px',duration)
+  end
+  return 1
+`
+
+// LuaTransferLock 转移锁的归属权：判断是否拥有锁的归属权，是则将锁的 token 替换为新 token 并保留剩余过期时间与元数据，返回 1；否则返回 0
+// ARGV[1]: 当前 token；ARGV[2]: 新 token
+const LuaTransferLock = luaTokenOf + `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local newToken = ARGV[2]
+  local value = redis.call('get',lockerKey)
+  local getToken = tokenOf(value)
   if (not getToken or getToken ~= targetToken) then
     return 0
-	else
-		return redis.call('expire',lockerKey,duration)
   end
+  local newValue = newToken
+  if (value ~= getToken) then
+    local decoded = cjson.decode(value)
+    decoded.token = newToken
+    newValue = cjson.encode(decoded)
+  end
+  local ttl = redis.call('pttl',lockerKey)
+  if (ttl > 0) then
+    redis.call('set',lockerKey,newValue,'px',ttl)
+  else
+    redis.call('set',lockerKey,newValue)
+  end
+  return 1
+`
+
+// LuaReentrantTransfer 可重入锁转移归属权：判断是否拥有锁的归属权，是则将重入次数转移给新 token，返回 1；否则返回 0
+// 先写入新 token 再删除旧 token，避免 hash 字段被删空导致锁(及其过期时间)被删除
+const LuaReentrantTransfer = `
+  local lockerKey = KEYS[1]
+  local targetToken = ARGV[1]
+  local newToken = ARGV[2]
+  local count = redis.call('hget',lockerKey,targetToken)
+  if (not count) then
+    return 0
+  end
+  redis.call('hincrby',lockerKey,newToken,count)
+  redis.call('hdel',lockerKey,targetToken)
+  return 1
+`
+
+// luaHolds 判断 token 是否拥有锁的归属权(兼容普通锁与可重入锁)
+const luaHolds = luaTokenOf + `
+  local function holds(lockerKey, targetToken)
+    local keyType = redis.call('type',lockerKey)['ok']
+    if (keyType == 'hash') then
+      return redis.call('hexists',lockerKey,targetToken) == 1
+    end
+    return keyType == 'string' and tokenOf(redis.call('get',lockerKey)) == targetToken
+  end
+`
+
+// LuaGuardedSet 判断是否拥有锁的归属权，是则写入受锁保护的数据，返回 1；否则返回 0
+// KEYS[1]: 锁的 key；KEYS[2]: 数据的 key；ARGV[1]: token；ARGV[2]: 写入的值
+const LuaGuardedSet = luaHolds + `
+  if (not holds(KEYS[1],ARGV[1])) then
+    return 0
+  end
+  redis.call('set',KEYS[2],ARGV[2])
+  return 1
+`
+
+// LuaGuardedGet 判断是否拥有锁的归属权，是则返回 {1, 数据的值}(数据不存在时为 {1})；否则返回 0
+// KEYS[1]: 锁的 key；KEYS[2]: 数据的 key；ARGV[1]: token
+const LuaGuardedGet = luaHolds + `
+  if (not holds(KEYS[1],ARGV[1])) then
+    return 0
+  end
+  local value = redis.call('get',KEYS[2])
+  if (not value) then
+    return {1}
+  end
+  return {1, value}
+`
+
+// LuaWaiterEnter 进入阻塞等锁：等锁计数 +1 并刷新计数的过期时间，返回当前的等锁数
+// ARGV[1]: 计数的过期时间(毫秒)，未能正常退出(如进程崩溃)的等锁方在计数过期后不再被计入
+const LuaWaiterEnter = `
+  local count = redis.call('incr',KEYS[1])
+  redis.call('pexpire',KEYS[1],tonumber(ARGV[1]))
+  return count
+`
+
+// LuaWaiterLeave 退出阻塞等锁：等锁计数 -1，计数不大于 1 时删除计数，保证计数不会出现负数，返回剩余的等锁数
+const LuaWaiterLeave = `
+  local count = tonumber(redis.call('get',KEYS[1]))
+  if (not count or count <= 1) then
+    redis.call('del',KEYS[1])
+    return 0
+  end
+  return redis.call('decr',KEYS[1])
 `
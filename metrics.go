@@ -0,0 +1,27 @@
+package redislock
+
+import "time"
+
+// Metrics 分布式锁的监控指标接口，可通过 WithMetrics 注入，将取锁耗时、锁竞争、续约、解锁等指标接入 Prometheus 等监控组件
+// 回调在加解锁的调用路径上同步执行，实现方应避免阻塞
+type Metrics interface {
+	// 一次 Lock/TryLock 调用结束，dur 为包括阻塞重试在内的总耗时
+	OnAcquire(success bool, dur time.Duration)
+	// 一次续约结束(看门狗续约或手动调用 DelayExpire)
+	OnRenew(success bool)
+	// 取锁时发现锁被他人持有，阻塞模式下每次重试失败都会触发
+	OnContention()
+	// 一次 Unlock 调用结束
+	OnUnlock(success bool)
+}
+
+// 默认的空实现，不采集任何指标
+type nopMetrics struct{}
+
+func (nopMetrics) OnAcquire(bool, time.Duration) {}
+
+func (nopMetrics) OnRenew(bool) {}
+
+func (nopMetrics) OnContention() {}
+
+func (nopMetrics) OnUnlock(bool) {}
@@ -0,0 +1,127 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// 部分 key 解锁失败
+var ErrMultiUnlockFailed = errors.New("unlock failed on some keys")
+
+// 同时锁定多个 key 的锁，每个 key 对应一把 RedisLock，所有 key 共用同一个 token
+// 死锁避免：key 在创建时去重并按字典序排序，Lock 总是按该顺序逐个加锁，
+// 所有 MultiLock 以相同的全局顺序申请锁，不会出现互相持有对方所需锁的环路等待
+// 任一 key 加锁失败时，按相反顺序释放已获取的锁
+type MultiLock struct {
+	keys  []string
+	locks []*RedisLock
+}
+
+// opts 作用于每一个 key 的锁
+func NewMultiLock(keys []string, client LockClient, opts ...LockOption) *MultiLock {
+	var o LockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	repairLock(&o)
+	opts = append(opts, WithToken(o.token))
+
+	// 去重并排序，保证全局一致的加锁顺序
+	seen := make(map[string]struct{}, len(keys))
+	sorted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	m := MultiLock{keys: sorted, locks: make([]*RedisLock, 0, len(sorted))}
+	for _, key := range sorted {
+		m.locks = append(m.locks, NewRedisLock(key, client, opts...))
+	}
+	return &m
+}
+
+// 按 key 的字典序逐个加锁，任一 key 加锁失败时释放已获取的锁并返回错误
+func (m *MultiLock) Lock(ctx context.Context) error {
+	for i, lock := range m.locks {
+		if err := lock.Lock(ctx); err != nil {
+			m.rollback(m.locks[:i])
+			return fmt.Errorf("lock key %s failed: %w", m.keys[i], err)
+		}
+	}
+	return nil
+}
+
+// 通过一次 lua 脚本原子地锁定所有 key(全部成功或全部失败)，阻塞、重试等行为与 Lock 一致
+// 所有 key 需位于同一个 redis 节点，cluster 模式下需借助 hash tag({...}) 保证位于同一槽位
+func (m *MultiLock) LockAtomic(ctx context.Context) error {
+	if len(m.locks) == 0 {
+		return nil
+	}
+
+	first := m.locks[0]
+	// 第一把锁负责阻塞重试并启动自身的看门狗，其余锁在加锁成功后启动看门狗
+	if err := first.lock(ctx, m.tryLockAtomic); err != nil {
+		return err
+	}
+	for _, lock := range m.locks[1:] {
+		lock.watchDog()
+	}
+	return nil
+}
+
+// 释放所有 key 的锁，部分 key 释放失败时返回汇总的错误
+func (m *MultiLock) Unlock(ctx context.Context) error {
+	var errs []error
+	for i := len(m.locks) - 1; i >= 0; i-- {
+		if err := m.locks[i].Unlock(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unlock key %s failed: %w", m.keys[i], err))
+		}
+	}
+	if len(errs) > 0 {
+		return &redLockError{sentinel: ErrMultiUnlockFailed, errs: errs}
+	}
+	return nil
+}
+
+func (m *MultiLock) tryLockAtomic(ctx context.Context) error {
+	first := m.locks[0]
+	expire, err := first.acquireExpire()
+	if err != nil {
+		return err
+	}
+
+	keyAndArgs := make([]interface{}, 0, len(m.locks)+2)
+	for _, lock := range m.locks {
+		keyAndArgs = append(keyAndArgs, lock.getLockKey())
+	}
+	keyAndArgs = append(keyAndArgs, first.lockValue, luaInt(expire.Milliseconds()))
+
+	reply, err := first.client.Eval(ctx, LuaMultiLock, len(m.locks), keyAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		first.metrics.OnContention()
+		return fmt.Errorf("some of keys %v are held by others: %w", m.keys, ErrLockAcquiredByOthers)
+	}
+	for _, lock := range m.locks {
+		lock.setAcquired(expire)
+	}
+	return nil
+}
+
+// 按相反顺序释放已获取的锁，调用方 ctx 可能已取消，使用独立的 ctx
+func (m *MultiLock) rollback(locks []*RedisLock) {
+	for i := len(locks) - 1; i >= 0; i-- {
+		if err := locks[i].Unlock(context.Background()); err != nil {
+			locks[i].logger.Error("多 key 加锁失败，回滚释放锁失败", "key", locks[i].getLockKey(), "err", err)
+		}
+	}
+}
@@ -1,6 +1,15 @@
 package redislock
 
-import "time"
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"redis_lock/utils"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
 
 const (
 	// 默认连接池超过 10 s 释放连接
@@ -9,11 +18,16 @@ const (
 	DefaultMaxActive = 100
 	// 默认最大空闲连接数
 	DefaultMaxIdle = 20
-
 	// 默认的分布式锁过期时间
 	DefaultLockExpireSeconds = 10
 	// 看门狗工作时间间隙
 	WatchDogWorkStepSeconds = 3
+	// 默认看门狗续约间隔
+	DefaultWatchDogInterval = WatchDogWorkStepSeconds * time.Second
+	// 阻塞模式下默认的轮询取锁间隔
+	DefaultPollInterval = 50 * time.Millisecond
+	// WithReplicationWait 未指定超时时间时，WAIT 默认的超时时间
+	DefaultReplicationWaitTimeout = 100 * time.Millisecond
 )
 
 // 连接池客户端参数
@@ -22,10 +36,35 @@ type ClientOptions struct {
 	idleTimeoutSeconds int
 	maxActive          int
 	wait               bool
+	dialTimeout        time.Duration // 建立连接超时时间
+	readTimeout        time.Duration // 读超时时间
+	writeTimeout       time.Duration // 写超时时间
+	useTLS             bool          // 是否使用 TLS 连接(rediss)
+	tlsConfig          *tls.Config
+	tlsSkipVerify      bool // 跳过服务端证书校验，仅用于测试环境
+	database           int  // 逻辑库编号
 	// 必填参数
 	network  string
 	address  string
 	password string
+	// 可选参数，redis 6+ ACL 用户名
+	username string
+
+	// 哨兵模式参数，masterName 非空时，每次拨号前通过哨兵解析当前主节点地址
+	masterName    string
+	sentinelAddrs []string
+
+	logger Logger
+
+	poolWaitHook    func(wait time.Duration, err error) // 获取连接发生等待或因连接池耗尽失败时的回调
+	poolWaitTimeout time.Duration                       // Wait 模式下等待连接的超时时间，<= 0 代表只受调用方 ctx 约束
+
+	skipTestOnBorrow  bool          // 借出连接时不做检查
+	healthCheckPeriod time.Duration // 仅检查空闲时间超过该周期的连接，非正时每次借出都检查
+
+	pool *redis.Pool // 外部传入的连接池，非空时不再创建新的连接池
+
+	err error // 选项校验失败的错误，构造函数或执行命令时返回
 }
 
 /*
@@ -66,6 +105,118 @@ func WithWaitMode() ClientOption {
 	}
 }
 
+// 建立连接的超时时间，避免 redis 不可达时拨号长时间阻塞
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.dialTimeout = timeout
+	}
+}
+
+// 读取 redis 响应的超时时间，避免 redis 卡住时 SetNX 等操作无限期阻塞
+func WithReadTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.readTimeout = timeout
+	}
+}
+
+// 向 redis 写入命令的超时时间
+func WithWriteTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.writeTimeout = timeout
+	}
+}
+
+// 使用指定的 TLS 配置连接 redis(云厂商托管 redis 常见)
+func WithTLS(cfg *tls.Config) ClientOption {
+	return func(c *ClientOptions) {
+		c.useTLS = true
+		c.tlsConfig = cfg
+	}
+}
+
+// 使用默认 TLS 配置连接 redis
+func WithTLSEnable() ClientOption {
+	return func(c *ClientOptions) {
+		c.useTLS = true
+	}
+}
+
+// 跳过服务端证书校验(会同时开启 TLS)，仅建议用于测试或自签名证书环境
+func WithTLSSkipVerify() ClientOption {
+	return func(c *ClientOptions) {
+		c.useTLS = true
+		c.tlsSkipVerify = true
+	}
+}
+
+// 指定 redis 密码，用于 NewSentinelClient 等不以参数传入密码的构造函数
+func WithPassword(password string) ClientOption {
+	return func(c *ClientOptions) {
+		c.password = password
+	}
+}
+
+// 指定 redis 6+ ACL 用户名，未设置时以 default 用户认证
+func WithUsername(username string) ClientOption {
+	return func(c *ClientOptions) {
+		c.username = username
+	}
+}
+
+// 选择 redis 逻辑库，将锁隔离在专用的库中；编号为负数时构造失败，超出服务端 databases 配置时拨号失败
+func WithDatabase(db int) ClientOption {
+	return func(c *ClientOptions) {
+		c.database = db
+	}
+}
+
+// 注入客户端日志组件
+func WithClientLogger(logger Logger) ClientOption {
+	return func(c *ClientOptions) {
+		c.logger = logger
+	}
+}
+
+// 连接池背压的回调，用于观测连接池是否过小：
+// Wait 模式下获取连接发生了等待、或获取连接因连接池耗尽(非 Wait 模式)/ctx 结束(Wait 模式)失败时调用，wait 为获取连接的耗时
+// 回调在获取连接的调用路径上同步执行，实现方应避免阻塞
+func WithPoolWaitHook(hook func(wait time.Duration, err error)) ClientOption {
+	return func(c *ClientOptions) {
+		c.poolWaitHook = hook
+	}
+}
+
+// 借出连接时是否检查连接可用(PING，哨兵模式下校验主节点角色)，默认开启
+// 高吞吐的短操作场景下关闭可省去每次借出的一次往返，代价是可能借出已失效的连接(哨兵模式下可能借出故障转移前的旧主节点连接)
+func WithTestOnBorrow(enable bool) ClientOption {
+	return func(c *ClientOptions) {
+		c.skipTestOnBorrow = !enable
+	}
+}
+
+// 仅在连接空闲时间超过 period 时才在借出前检查连接，最近使用过的连接直接借出
+func WithHealthCheckPeriod(period time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.healthCheckPeriod = period
+	}
+}
+
+// Wait 模式下从连接池获取连接的最长等待时间，独立于调用方的 ctx，超时返回 ErrPoolExhausted
+// 便于区分 "连接池过小" 与 "redis 响应慢"，并避免连接池耗尽时取锁的耗时无上限
+func WithPoolWaitTimeout(d time.Duration) ClientOption {
+	return func(c *ClientOptions) {
+		c.poolWaitTimeout = d
+	}
+}
+
+// 复用外部已配置好的连接池(自定义 Dial、TLS 等)，避免对同一个 redis 建立重复的连接池
+// 此时 network、address 及连接池、拨号相关的选项均不生效，Client 关闭时也不会关闭该连接池，由创建方负责关闭
+func WithClientPool(pool *redis.Pool) ClientOption {
+	return func(c *ClientOptions) {
+		c.pool = pool
+	}
+}
+
 // 确保参数合法
 func repairClient(c *ClientOptions) {
 	if c.maxIdle < 0 {
@@ -79,14 +230,68 @@ func repairClient(c *ClientOptions) {
 	if c.maxActive < 0 {
 		c.maxActive = DefaultMaxActive
 	}
+
+	if c.logger == nil {
+		c.logger = newLogger()
+	}
+
+	// 不回退到 0 号库，否则锁会与其他业务共用同一个库，违背隔离的初衷
+	// 编号上限取决于服务端的 databases 配置，由 SELECT 校验
+	if c.database < 0 {
+		c.err = fmt.Errorf("%w, got: %d", ErrInvalidDatabase, c.database)
+	}
 }
 
 // 分布式锁参数
 type LockOptions struct {
 	isBlock             bool
 	blockWaitingSeconds int64
-	expireSeconds       int64
-	watchDogMode        bool // 不显式指定锁的过期时间，会自动启动看门狗 (自动更新过期时间)
+	expireDuration      time.Duration // 锁的过期时间，支持毫秒级
+	watchDogMode        bool          // 不显式指定锁的过期时间，会自动启动看门狗 (自动更新过期时间)
+	reentrant           bool          // 可重入模式，锁以 hash 存储 token -> 重入次数
+	watchDogInterval    time.Duration // 看门狗续约间隔，每次续约的过期时间为该间隔的两倍
+	logger              Logger
+	token               string                          // 当前加锁方唯一标识，用户指定时优先级高于 tokenGenerator
+	tokenGenerator      func() string                   // 用户指定的 token 生成函数
+	tokenPerLock        bool                            // 每次加锁生成新的 token
+	pollInterval        time.Duration                   // 阻塞模式下轮询取锁的间隔
+	pollJitter          time.Duration                   // 轮询间隔的随机抖动上限，避免大量等锁方同时请求 redis
+	notifyWait          bool                            // 阻塞模式下订阅解锁通知，收到通知立即重试取锁
+	notifyChannel       func(key string) string         // 由锁的 key 生成解锁通知的 channel
+	acquireTimeout      time.Duration                   // 单次 Lock 调用(包括重试)的总超时时间
+	metrics             Metrics                         // 监控指标
+	fairQueue           bool                            // 公平锁模式，等锁方按排队顺序(FIFO)取锁
+	contentionTracking  bool                            // 阻塞等锁时登记等锁计数，可通过 Contention 查询
+	maxRetries          int                             // 阻塞模式下的最大重试次数，<= 0 代表不限制
+	backoffInitial      time.Duration                   // 指数退避的初始轮询间隔，<= 0 代表不启用指数退避
+	backoffMax          time.Duration                   // 指数退避的轮询间隔上限
+	backoffFactor       float64                         // 指数退避每次重试的间隔增长倍数
+	watchDogCtx         context.Context                 // 看门狗 ctx 的父 ctx，默认为 context.Background()
+	expireSet           bool                            // 是否显式指定了过期时间
+	ownerDiagnostics    bool                            // 取锁失败时查询并返回当前持有者
+	expireAt            time.Time                       // 锁的绝对过期时刻，非零时每次取锁以剩余时间作为过期时间
+	monitorInterval     time.Duration                   // 非看门狗模式下检查锁归属权的间隔，<= 0 代表不检查
+	noWatchDog          bool                            // 强制关闭看门狗，未指定过期时间时使用默认过期时间且不续约
+	immediateRenewal    bool                            // 看门狗启动后立即续约一次
+	acquireScript       string                          // 自定义加锁脚本，为空时使用 SET NX
+	releaseScript       string                          // 自定义解锁脚本，为空时使用 LuaCheckAndDeleteDistributionLock
+	renewScript         string                          // 自定义续约脚本，为空时使用 LuaCheckAndExpireDistributionLock/LuaCheckAndPExpireDistributionLock
+	keyPrefix           string                          // 锁的 key 前缀，默认为 RedisLockKeyPrefix
+	renewJitter         time.Duration                   // 看门狗每次续约的过期时间的随机抖动上限
+	errBufferSize       int                             // 看门狗错误通道的缓冲区大小
+	errDropPolicy       DropPolicy                      // 看门狗错误通道缓冲区已满时的丢弃策略
+	nonAtomicUnlock     bool                            // 解锁时以 GET + DEL 代替 lua 脚本
+	onWatchDogStart     func()                          // 看门狗启动时的回调
+	onWatchDogStop      func(reason WatchDogStopReason) // 看门狗退出时的回调
+	metadata            map[string]string
+	lockValue           string                          // 写入 redis 的锁的值，开启 WithMetadata 时为包含 token 与元数据的 JSON，否则即为 token
+	renewer             Renewer                         // 看门狗的续约器，默认基于 DelayExpire 续约
+	newTicker           func(d time.Duration) ticker    // 看门狗的续约节拍，测试时可注入手动触发的节拍
+	replicaWait         int                             // 加锁后需确认写入的从节点数，<= 0 代表不等待
+	replicaWaitTimeout  time.Duration                   // WAIT 的超时时间
+	logContextFields    func(ctx context.Context) []any // 从 ctx 中提取附加到每条日志的 key/value
+	minHoldTime         time.Duration                   // 锁的最短持有时间，Unlock 等待锁被持有满该时长后才释放
+	err                 error                           // 选项校验失败的错误，Lock/TryLock 时返回
 }
 
 type LockOption func(*LockOptions)
@@ -103,26 +308,469 @@ func WithBlockWaitingSeconds(waitingSeconds int64) LockOption {
 	}
 }
 
+// 显式指定锁的过期时间(秒)，此时不启动看门狗(IsWatchDogMode 返回 false)，锁在过期时间后自动释放，需要更多时间时调用 Extend
+// 未指定过期时间时使用默认的 10s 并启动看门狗自动续约；显式指定 <= 0 的值视为误用，Lock/TryLock 返回 ErrInvalidExpire，而不是退化为看门狗模式
 func WithExpireSeconds(expireSeconds int64) LockOption {
 	return func(lo *LockOptions) {
-		lo.expireSeconds = expireSeconds
+		lo.expireDuration = time.Duration(expireSeconds) * time.Second
+		lo.expireSet = true
+	}
+}
+
+// 以绝对时刻指定锁的过期时间，例如定时任务的截止时刻；每次取锁时以距离该时刻的剩余时间作为过期时间
+// 该模式下不启动看门狗；取锁时该时刻已过则返回 ErrExpireAtPassed；优先级高于 WithExpireSeconds/WithExpireDuration
+func WithExpireAt(t time.Time) LockOption {
+	return func(lo *LockOptions) {
+		lo.expireAt = t
+	}
+}
+
+// 以 time.Duration 指定锁的过期时间，支持亚秒级(如 200ms)，非整秒时使用 PX/PEXPIRE
+// 与 WithExpireSeconds 一致，显式指定 <= 0 的值时 Lock/TryLock 返回 ErrInvalidExpire
+func WithExpireDuration(d time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.expireDuration = d
+		lo.expireSet = true
+	}
+}
+
+// 开启可重入模式，同一 token 可多次加锁，解锁次数与加锁次数相同时才真正释放锁
+func WithReentrant() LockOption {
+	return func(lo *LockOptions) {
+		lo.reentrant = true
+	}
+}
+
+// 设置看门狗续约间隔，每次续约的过期时间为 2*d
+// d 需小于锁的过期时间，否则会被自动缩短为过期时间的三分之一
+func WithWatchDogInterval(d time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.watchDogInterval = d
+	}
+}
+
+// 看门狗启动后立即续约一次，再按续约间隔周期性续约
+// 默认首次续约发生在加锁成功一个续约间隔之后，网络延迟较大时可借此收紧安全余量，代价是每次加锁多一次续约请求
+func WithImmediateRenewal() LockOption {
+	return func(lo *LockOptions) {
+		lo.immediateRenewal = true
+	}
+}
+
+// 自定义加锁脚本，替换默认的 SET NX，仅对不可重入锁生效
+// 脚本约定：KEYS[1] 为锁的 key，ARGV[1] 为 token，ARGV[2] 为过期时间(毫秒)；加锁成功返回 1，否则返回 0
+// 脚本在首次使用时通过 SCRIPT LOAD 加载，语法错误会在首次加锁时返回
+func WithAcquireScript(script string) LockOption {
+	return func(lo *LockOptions) {
+		lo.acquireScript = script
+	}
+}
+
+// 自定义解锁脚本，替换 LuaCheckAndDeleteDistributionLock，仅对不可重入锁生效
+// 脚本约定：KEYS[1] 为锁的 key，ARGV[1] 为 token；解锁成功返回 1，不持有锁时返回 0
+func WithReleaseScript(script string) LockOption {
+	return func(lo *LockOptions) {
+		lo.releaseScript = script
+	}
+}
+
+// 自定义续约脚本，替换 LuaCheckAndExpireDistributionLock/LuaCheckAndPExpireDistributionLock，作用于看门狗续约与 Extend，仅对不可重入锁生效
+// 脚本约定：KEYS[1] 为锁的 key，ARGV[1] 为 token，ARGV[2] 为续约时长(毫秒)；返回续约后的剩余过期时间(毫秒)，不持有锁时返回 0
+func WithRenewScript(script string) LockOption {
+	return func(lo *LockOptions) {
+		lo.renewScript = script
+	}
+}
+
+// 指定锁的 key 前缀，替换默认的 RedisLockKeyPrefix，多个服务共用一个 redis 时可借此隔离各自的锁，例如 "svc-orders:"
+// 公平锁的等锁队列、等锁计数的 key 同样以该前缀为命名空间，如 "svc-orders:REDIS_LOCK_WAITERS_" + key
+// 同一把锁的所有持有方需使用相同的前缀；为空时使用默认前缀
+func WithKeyPrefix(prefix string) LockOption {
+	return func(lo *LockOptions) {
+		lo.keyPrefix = prefix
+	}
+}
+
+// 注入分布式锁日志组件，未设置时使用默认的标准输出日志
+func WithLogger(logger Logger) LockOption {
+	return func(lo *LockOptions) {
+		lo.logger = logger
+	}
+}
+
+// 指定锁的 token，例如稳定的 UUID 或实例 ID，使进程重启后仍能识别、校验锁的归属
+func WithToken(token string) LockOption {
+	return func(lo *LockOptions) {
+		lo.token = token
+	}
+}
+
+// 指定锁 token 的生成函数，未设置时默认使用 crypto/rand 生成的随机 UUID
+// 需要在 token 中体现进程、协程以便调试时，可使用 WithTokenGenerator(utils.GetProcessAndGoroutineIDStr)，但协程 ID 可能被复用
+func WithTokenGenerator(generator func() string) LockOption {
+	return func(lo *LockOptions) {
+		lo.tokenGenerator = generator
+	}
+}
+
+// 复用同一实例循环加锁时，每次加锁(Lock/TryLock)都生成新的 token(使用 WithTokenGenerator 或随机 UUID)，使每次持有锁可区分
+// 仍持有锁时再次加锁沿用当前 token；此模式下实例不应被多个协程并发加锁；与 WithToken 同时使用时不生效
+func WithTokenPerLock() LockOption {
+	return func(lo *LockOptions) {
+		lo.tokenPerLock = true
+	}
+}
+
+// 阻塞模式下轮询取锁的间隔，默认 50ms
+func WithPollInterval(d time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.pollInterval = d
+	}
+}
+
+// 为轮询间隔增加 [0, jitter) 的随机抖动，缓解激烈竞争下大量等锁方同时重试造成的惊群
+func WithPollJitter(jitter time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.pollJitter = jitter
 	}
 }
 
+// 看门狗每次续约的过期时间增加 [0, jitter) 的随机抖动，大量锁同时加锁时错开它们的过期时刻，平滑 redis 负载
+// 抖动只会延长过期时间，不会使其短于续约间隔；jitter 超过续约间隔时以续约间隔为上限
+func WithRenewJitter(jitter time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.renewJitter = jitter
+	}
+}
+
+// 指定看门狗错误通道(Errors())的缓冲区大小，以及缓冲区已满时的丢弃策略
+// size <= 0 时使用默认大小 1；默认丢弃最新的错误(DropNewest)
+func WithErrorsBuffer(size int, policy DropPolicy) LockOption {
+	return func(lo *LockOptions) {
+		lo.errBufferSize = size
+		lo.errDropPolicy = policy
+	}
+}
+
+// 在锁的值中附带元数据(如主机名、任务 ID)，便于排查长时间未释放的锁由谁持有，可通过 Inspect 查询
+// 锁的值以 {"token":...,"metadata":{...}} 格式的 JSON 存储，归属权校验只比较其中的 token；仅对不可重入锁生效
+func WithMetadata(metadata map[string]string) LockOption {
+	return func(lo *LockOptions) {
+		lo.metadata = metadata
+	}
+}
+
+// 加锁成功后通过 WAIT 等待锁复制到至少 numReplicas 个从节点，timeout 内确认数不足时释放锁，返回 ErrReplicationTimeout
+// 用于缩小单主多从部署下，锁尚未复制即发生主从切换、导致锁被他人获取的窗口；这只是尽力而为，并不等同于共识保证，需要更强的安全性时请使用 RedLock
+// 仅对默认的 SET NX 加锁方式生效(可重入、公平锁、自定义加锁脚本等模式下不生效)，客户端需实现 ReplicationClient
+func WithReplicationWait(numReplicas int, timeout time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.replicaWait = numReplicas
+		lo.replicaWaitTimeout = timeout
+	}
+}
+
+// 从调用方传入的 ctx 中提取 key/value(如 trace ID、request ID)，附加到锁的每条日志上，便于与请求链路关联
+// 看门狗的日志使用看门狗的 ctx(派生自 WithWatchDogContext 指定的 ctx)提取字段
+func WithLogContextFields(fn func(ctx context.Context) []any) LockOption {
+	return func(lo *LockOptions) {
+		lo.logContextFields = fn
+	}
+}
+
+// 解锁时以 GET 比较 token 后 DEL 代替 lua 脚本，用于禁用了 EVAL 的 redis；默认使用原子的 lua 脚本解锁
+// 警告：两步之间锁可能恰好过期并被他人获取，此时会误删他人的锁；仅对不可重入锁生效，开启后 WithReleaseScript 不再生效
+func WithNonAtomicUnlock() LockOption {
+	return func(lo *LockOptions) {
+		lo.nonAtomicUnlock = true
+	}
+}
+
+// 看门狗(或 WithOwnershipMonitor 的归属权检查)启动时的回调，在看门狗协程中调用
+func WithOnWatchDogStart(fn func()) LockOption {
+	return func(lo *LockOptions) {
+		lo.onWatchDogStart = fn
+	}
+}
+
+// 看门狗(或 WithOwnershipMonitor 的归属权检查)退出时的回调，reason 区分被 Unlock 停止、watchDogCtx 结束与锁已丢失
+// 可用于发现看门狗在任务结束前提前退出；回调在看门狗协程中、错误通道关闭后调用
+func WithOnWatchDogStop(fn func(reason WatchDogStopReason)) LockOption {
+	return func(lo *LockOptions) {
+		lo.onWatchDogStop = fn
+	}
+}
+
+// 替换看门狗默认的续约器(基于 DelayExpire)，看门狗每个续约间隔调用一次 renewer.Renew，返回的错误发送至 Errors() 通道
+// 自定义续约器需自行保证锁的过期时间被延长，否则锁会在到期后丢失
+func WithRenewer(renewer Renewer) LockOption {
+	return func(lo *LockOptions) {
+		lo.renewer = renewer
+	}
+}
+
+// 开启解锁通知模式：Unlock 释放锁后通过 PUBLISH 发布通知，阻塞等锁方 SUBSCRIBE 该通知并立即重试取锁，
+// 轮询仍作为兜底。通知是 at-most-once 的：订阅建立前发生的解锁、或网络异常时的通知可能丢失，此时依赖轮询取锁
+// 需要 LockClient 实现 NotifyClient 接口，否则退化为轮询
+func WithNotifyWait() LockOption {
+	return func(lo *LockOptions) {
+		lo.notifyWait = true
+	}
+}
+
+// 自定义解锁通知的 channel 名称，默认为 RedisLockNotifyPrefix + key
+// 多个服务共用一个 redis 时可借此为 channel 加上命名空间，避免相互干扰，也便于运维按 channel 监控
+// 同一把锁的所有持有方需使用相同的规则；生成的 channel 为空时 Lock/TryLock 返回 ErrEmptyNotifyChannel
+func WithNotifyChannel(channel func(key string) string) LockOption {
+	return func(lo *LockOptions) {
+		lo.notifyChannel = channel
+	}
+}
+
+// 指定看门狗的父 ctx，例如应用生命周期的 ctx：应用退出时 ctx 结束，所有锁的看门狗随之停止续约
+// 看门狗的 ctx 由其派生，Unlock 仍会取消派生的 ctx；未设置时使用 context.Background()
+func WithWatchDogContext(ctx context.Context) LockOption {
+	return func(lo *LockOptions) {
+		lo.watchDogCtx = ctx
+	}
+}
+
+// 关闭看门狗：未指定过期时间时使用默认过期时间(DefaultLockExpireSeconds)，且锁到期后不会自动续约
+// 用于区分 "未指定过期时间" 与 "不需要续约"
+func WithNoWatchDog() LockOption {
+	return func(lo *LockOptions) {
+		lo.noWatchDog = true
+	}
+}
+
+// 非看门狗模式下，加锁成功后每隔 interval 在后台检查一次锁是否仍由自己持有
+// 任务执行超过锁的过期时间、锁被他人取得时，向 Errors() 通道发送 ErrLockNotHeld 并停止检查，WithLock 会随之取消 fn 的 ctx
+// 看门狗模式下续约本身即可发现锁丢失，该选项不生效；默认关闭
+func WithOwnershipMonitor(interval time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.monitorInterval = interval
+	}
+}
+
+// 阻塞模式下以指数退避的方式轮询取锁：第 n 次重试前等待 initial*factor^n(不超过 max)，并随机减少至多一半，避免等锁方同步重试
+// 每次 Lock 调用从 initial 重新开始；未设置时保持固定的 pollInterval 轮询
+// factor < 1 时使用 2，max < initial 时使用 initial
+func WithBackoff(initial, max time.Duration, factor float64) LockOption {
+	return func(lo *LockOptions) {
+		lo.backoffInitial = initial
+		lo.backoffMax = max
+		lo.backoffFactor = factor
+	}
+}
+
+// 取锁失败时返回 *LockHeldError，其中包含当前持有者的 token，便于排查锁竞争，无需再额外 GET 持有者
+// 非阻塞模式下 Lock 直接返回该错误；阻塞模式下等锁超时、重试次数用尽时返回的错误中保留最近一次的持有者，均可通过 errors.As 取出
+// 加锁改为通过 lua 脚本执行(SET NX 失败时在同一脚本内 GET 持有者)，比默认的 SET NX 略慢，建议用于调试或排查问题；仅对不可重入锁生效
+func WithOwnerDiagnostics() LockOption {
+	return func(lo *LockOptions) {
+		lo.ownerDiagnostics = true
+	}
+}
+
+// 阻塞模式下最多重试 n 次(不含首次取锁)，用尽后返回 ErrLockAcquiredByOthers
+// 与 blockWaitingSeconds、ctx 同时生效，先到者生效；n <= 0 代表不限制重试次数
+func WithMaxRetries(n int) LockOption {
+	return func(lo *LockOptions) {
+		lo.maxRetries = n
+	}
+}
+
+// 锁自加锁起至少持有 d：提前完成任务时，Unlock 阻塞至持有满 d 后再释放，避免等锁方频繁地交替取锁
+// Unlock 的 ctx 结束时放弃等待并返回包装了 ctx 错误的 error，此时锁未释放(看门狗模式下继续续约)，需再次 Unlock
+// 可重入模式下每次 Unlock 均会等待，以首次加锁的时刻计算
+func WithMinHoldTime(d time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.minHoldTime = d
+	}
+}
+
+// 阻塞等锁期间在 redis 中登记等锁计数(进入阻塞等锁时 +1，退出时 -1)，可通过 Contention 查询锁的竞争程度
+// 每次进入阻塞等锁多两次 redis 请求；首次取锁即成功时不登记
+func WithContentionTracking() LockOption {
+	return func(lo *LockOptions) {
+		lo.contentionTracking = true
+	}
+}
+
+// 开启公平锁模式：等锁方按照首次尝试取锁的先后排队，只有队首的等锁方可以取锁，取锁成功后出队，
+// 放弃等锁(失败、ctx 取消、超时)时主动出队；崩溃的等锁方在其最长等锁时间后被清理出队
+// 与默认的轮询模式相比，等锁时间有界、不会饿死，但每次取锁多一次有序集合操作，且队首等锁方轮询到锁之前锁保持空闲，吞吐更低
+// 等锁队列的 key 附带锁 key 的 hash tag，cluster 模式下与锁位于同一槽位
+// 仅对不可重入锁生效
+func WithFairQueue() LockOption {
+	return func(lo *LockOptions) {
+		lo.fairQueue = true
+	}
+}
+
+// 限制单次 Lock 调用(包括非阻塞模式下的 redis 请求、阻塞模式下的全部重试)的总耗时，
+// 超时返回包装了 context.DeadlineExceeded 的错误；与 blockWaitingSeconds 同时设置时，先到者生效
+// 加锁成功后看门狗不受该超时影响
+func WithAcquireTimeout(timeout time.Duration) LockOption {
+	return func(lo *LockOptions) {
+		lo.acquireTimeout = timeout
+	}
+}
+
+// 注入监控指标的实现，未设置时不采集指标
+func WithMetrics(metrics Metrics) LockOption {
+	return func(lo *LockOptions) {
+		lo.metrics = metrics
+	}
+}
+
+// 下一次轮询取锁前的等待时间
+// retries 为已重试的次数，仅在指数退避模式下使用
+func (lo *LockOptions) nextPollInterval(retries int) time.Duration {
+	interval := lo.pollInterval
+	if lo.backoffInitial > 0 {
+		interval = lo.backoffInterval(retries)
+	}
+	if lo.pollJitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(int64(lo.pollJitter)))
+}
+
+// 指数退避的轮询间隔 initial*factor^retries，不超过 backoffMax，并随机减少至多一半
+func (lo *LockOptions) backoffInterval(retries int) time.Duration {
+	interval := lo.backoffInitial
+	for i := 0; i < retries && interval < lo.backoffMax; i++ {
+		interval = time.Duration(float64(interval) * lo.backoffFactor)
+	}
+	if interval > lo.backoffMax {
+		interval = lo.backoffMax
+	}
+	if half := int64(interval / 2); half > 0 {
+		interval -= time.Duration(rand.Int63n(half))
+	}
+	return interval
+}
+
+// 看门狗每次续约的过期时间，为续约间隔的两倍，多出的一个间隔用于抵御网络延迟
+// 开启 WithRenewJitter 时再增加 [0, renewJitter) 的随机抖动
+func (lo *LockOptions) renewExpireDuration() time.Duration {
+	if lo.renewJitter <= 0 {
+		return 2 * lo.watchDogInterval
+	}
+	return 2*lo.watchDogInterval + time.Duration(rand.Int63n(int64(lo.renewJitter)))
+}
+
+// 生成 token，优先使用用户指定的生成函数，未指定或生成为空时使用随机 UUID
+func (lo *LockOptions) newToken() string {
+	if lo.tokenGenerator != nil {
+		if token := lo.tokenGenerator(); token != "" {
+			return token
+		}
+	}
+	return utils.NewRandomToken()
+}
+
 func repairLock(lo *LockOptions) {
+	if lo.logger == nil {
+		lo.logger = newLogger()
+	}
+	if lo.metrics == nil {
+		lo.metrics = nopMetrics{}
+	}
+	if lo.watchDogCtx == nil {
+		lo.watchDogCtx = context.Background()
+	}
+	if lo.keyPrefix == "" {
+		lo.keyPrefix = RedisLockKeyPrefix
+	}
+	if lo.errBufferSize <= 0 {
+		lo.errBufferSize = watchDogErrChanSize
+	}
+	if lo.notifyChannel == nil {
+		lo.notifyChannel = func(key string) string {
+			return RedisLockNotifyPrefix + key
+		}
+	}
+	if lo.onWatchDogStart == nil {
+		lo.onWatchDogStart = func() {}
+	}
+	if lo.onWatchDogStop == nil {
+		lo.onWatchDogStop = func(WatchDogStopReason) {}
+	}
+	if lo.nonAtomicUnlock {
+		lo.logger.Error("已开启非原子解锁，锁在 GET 与 DEL 之间过期时可能误删他人的锁")
+	}
+
+	if lo.token != "" {
+		// 显式指定的 token 固定不变
+		lo.tokenPerLock = false
+	} else {
+		lo.token = lo.newToken()
+	}
+	lo.lockValue = encodeLockValue(lo.token, lo.metadata)
+
+	if lo.backoffInitial > 0 {
+		if lo.backoffFactor < 1 {
+			lo.backoffFactor = 2
+		}
+		if lo.backoffMax < lo.backoffInitial {
+			lo.backoffMax = lo.backoffInitial
+		}
+	}
+
 	if lo.isBlock && lo.blockWaitingSeconds <= 0 {
 		// 默认阻塞等待时间上限为 5 秒
 		lo.blockWaitingSeconds = 5
 	}
 
+	if lo.pollInterval <= 0 {
+		lo.pollInterval = DefaultPollInterval
+	}
+
+	// WAIT 的超时时间为 0 时会一直阻塞，不允许
+	if lo.replicaWait > 0 && lo.replicaWaitTimeout <= 0 {
+		lo.replicaWaitTimeout = DefaultReplicationWaitTimeout
+	}
+
+	// 过期时刻是绝对的，由取锁时计算剩余时间，不启动看门狗
+	if !lo.expireAt.IsZero() {
+		lo.watchDogMode = false
+		return
+	}
+
+	// 显式指定了不合法的过期时间，不能悄悄退化为看门狗模式
+	if lo.expireSet && lo.expireDuration <= 0 {
+		lo.err = fmt.Errorf("%w, got: %v", ErrInvalidExpire, lo.expireDuration)
+		return
+	}
+
 	// ***倘若未设置分布式锁的过期时间，则会启动 watchdog***
-	if lo.expireSeconds > 0 {
+	if lo.expireDuration > 0 {
 		return
 	}
 
 	// 用户未显式指定锁的过期时间，此时会设定默认过期时间，并启动看门狗 (自动更新过期时间)
-	lo.expireSeconds = DefaultLockExpireSeconds
+	lo.expireDuration = DefaultLockExpireSeconds * time.Second
+	// 显式关闭了看门狗，仅使用默认过期时间
+	if lo.noWatchDog {
+		return
+	}
 	lo.watchDogMode = true
+
+	if lo.watchDogInterval <= 0 {
+		lo.watchDogInterval = DefaultWatchDogInterval
+	}
+	// 续约间隔必须严格小于锁的过期时间，否则锁会在两次续约之间过期；此时将续约间隔缩短为过期时间的三分之一
+	if lo.watchDogInterval >= lo.expireDuration {
+		interval := lo.expireDuration / 3
+		lo.logger.Error("看门狗续约间隔不小于锁的过期时间，锁会在续约前过期，已自动缩短续约间隔",
+			"interval", lo.watchDogInterval, "expire", lo.expireDuration, "adjusted_interval", interval)
+		lo.watchDogInterval = interval
+	}
+	if lo.renewJitter > lo.watchDogInterval {
+		lo.renewJitter = lo.watchDogInterval
+	}
 }
 
 type RedLockOption func(*RedLockOptions)
@@ -130,6 +778,12 @@ type RedLockOption func(*RedLockOptions)
 type RedLockOptions struct {
 	singleNodesTimeout time.Duration // 单节点获取锁过期时间，所有节点之和 小于 分布式锁过期时间的十分之一
 	expireDuration     time.Duration // 分布式锁过期时间
+	logger             Logger
+	watchDogMode       bool          // 红锁看门狗模式，加锁成功后周期性地在多数节点上续约
+	quorum             int           // 加锁/续约成功所需的最少节点数，默认为 节点数/2+1
+	pingOnCreate       bool          // 创建红锁时检查各节点的连通性
+	driftFactor        float64       // 时钟漂移系数，漂移 = 过期时间 * driftFactor + driftConstant
+	driftConstant      time.Duration // 时钟漂移常量
 }
 
 func WithSingleNodesTimeout(singleNodesTimeout time.Duration) RedLockOption {
@@ -144,16 +798,99 @@ func WithRedLockExpireDuration(duration time.Duration) RedLockOption {
 	}
 }
 
+// 开启红锁看门狗，加锁成功后每隔过期时间的三分之一在所有节点上续约，解锁时停止
+func WithRedLockWatchDog() RedLockOption {
+	return func(o *RedLockOptions) {
+		o.watchDogMode = true
+	}
+}
+
+// 指定加锁/续约成功所需的最少节点数，需不大于节点总数
+// 小于多数派(节点数/2+1)时，两个客户端可能同时持有红锁，请谨慎权衡可用性与安全性
+func WithQuorum(quorum int) RedLockOption {
+	return func(o *RedLockOptions) {
+		o.quorum = quorum
+	}
+}
+
+// 注入红锁日志组件，同时作用于每个节点上的锁
+func WithRedLockLogger(logger Logger) RedLockOption {
+	return func(o *RedLockOptions) {
+		o.logger = logger
+	}
+}
+
+// 创建红锁时 PING 所有节点：可达节点数不少于 quorum 时创建成功，不可达的节点被标记为下线，
+// 加锁、续约时直接跳过(视为该节点失败)，直到 HealthCheck 发现其恢复；可达节点数少于 quorum 时返回错误
+func WithPingOnCreate() RedLockOption {
+	return func(o *RedLockOptions) {
+		o.pingOnCreate = true
+	}
+}
+
+// 指定时钟漂移系数，计算锁的剩余有效期时扣除 过期时间 * factor 的时钟漂移，默认为 DefaultDriftFactor
+func WithDriftFactor(factor float64) RedLockOption {
+	return func(o *RedLockOptions) {
+		o.driftFactor = factor
+	}
+}
+
+// 指定时钟漂移常量，计算锁的剩余有效期时额外扣除，默认为 DefaultDriftConstant
+func WithDriftConstant(d time.Duration) RedLockOption {
+	return func(o *RedLockOptions) {
+		o.driftConstant = d
+	}
+}
+
 // 每一个 redis 节点
 type SingleNodeConf struct {
 	Network  string
 	Address  string
 	Password string
 	Opts     []ClientOption
+	Timeout  time.Duration // 该节点的单节点超时时间，如距离较远的节点可设置更大的超时；未设置时使用 singleNodesTimeout
 }
 
-func repairRedLock(o *RedLockOptions) {
+// nodeTimeouts 为各节点的超时时间，未设置(非正)的节点修正为 singleNodesTimeout
+func repairRedLock(o *RedLockOptions, nodeTimeouts []time.Duration) {
 	if o.singleNodesTimeout <= 0 {
 		o.singleNodesTimeout = DefaultSingleLockTimeout
 	}
+
+	var total time.Duration
+	for i := range nodeTimeouts {
+		if nodeTimeouts[i] <= 0 {
+			nodeTimeouts[i] = o.singleNodesTimeout
+		}
+		total += nodeTimeouts[i]
+	}
+
+	if o.logger == nil {
+		o.logger = newLogger()
+	}
+
+	// 未指定红锁过期时间时使用默认的过期时间，节点锁以固定的过期时间加锁，不会进入节点级的看门狗模式
+	// 默认过期时间需满足 所有节点累计的超时时间 不超过过期时间的十分之一
+	if o.expireDuration <= 0 {
+		o.expireDuration = DefaultLockExpireSeconds * time.Second
+		if budget := total * 10; budget > o.expireDuration {
+			o.expireDuration = budget
+		}
+	}
+
+	if o.driftFactor <= 0 {
+		o.driftFactor = DefaultDriftFactor
+	}
+	if o.driftConstant <= 0 {
+		o.driftConstant = DefaultDriftConstant
+	}
+
+	nodes := len(nodeTimeouts)
+
+	if o.quorum <= 0 {
+		o.quorum = nodes/2 + 1
+	}
+	if o.quorum <= nodes/2 {
+		o.logger.Error("红锁 quorum 未达到多数派，可能出现多个客户端同时持有锁", "quorum", o.quorum, "nodes", nodes)
+	}
 }
@@ -1,11 +1,32 @@
 package redislock
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"runtime"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
 )
 // go test -count=1 -run ^Test_NewClient$ redis_lock
 func Test_NewClient(t *testing.T) {
@@ -21,6 +42,399 @@ func Test_NewClient(t *testing.T) {
 	t.Log(a)
 }
 
+// Set 设置的过期时间应生效，到期后 key 被删除
+func Test_ClientSetExpire(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	if _, err := client.Set(ctx, "test_set_expire_key", "value", 2); err != nil {
+		t.Fatal(err)
+	}
+	pttl, err := client.PTTL(ctx, "test_set_expire_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pttl <= 0 || pttl > 2000 {
+		t.Errorf("expect pttl in (0, 2000], got: %d", pttl)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+	if exists, err := client.Exists(ctx, "test_set_expire_key"); err != nil || exists {
+		t.Errorf("key should be expired, exists: %v, err: %v", exists, err)
+	}
+}
+
+// 关闭后的客户端，后续操作应返回错误而不是 panic
+func Test_ClientClose(t *testing.T) {
+	client := NewClient("tcp", "172.17.224.1:6379", "")
+	if err := client.Close(); err != nil {
+		t.Fatalf("client.Close failed: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := client.Get(ctx, "test_key"); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("Get after Close should return ErrClientClosed, got: %v", err)
+	}
+	if _, err := client.SetNX(ctx, "test_key", "token", 1); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("SetNX after Close should return ErrClientClosed, got: %v", err)
+	}
+
+	// 重复关闭不报错
+	if err := client.Close(); err != nil {
+		t.Errorf("second Close failed: %v", err)
+	}
+}
+
+// 基于进程内 TLS redis mock，验证 TLS 拨号链路
+func Test_ClientTLS(t *testing.T) {
+	addr, roots := startTLSRedisMock(t, func(args []string) string {
+		return "$6\r\ntls_ok\r\n"
+	})
+
+	client := NewClient("tcp", addr, "", WithTLSSkipVerify())
+	defer client.Close()
+
+	v, err := client.Get(context.Background(), "test_key")
+	if err != nil {
+		t.Fatalf("Get over TLS failed: %v", err)
+	}
+	if v != "tls_ok" {
+		t.Errorf("unexpected value: %s", v)
+	}
+
+	// WithTLS 的配置经 DialTLSConfig 作用于拨号：信任自签名证书时连接成功，否则证书校验失败
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		wantErr bool
+	}{
+		{name: "trusted config", opts: []ClientOption{WithTLS(&tls.Config{RootCAs: roots})}},
+		{name: "untrusted config", opts: []ClientOption{WithTLS(&tls.Config{})}, wantErr: true},
+		{name: "untrusted config with skip verify", opts: []ClientOption{WithTLS(&tls.Config{}), WithTLSSkipVerify()}},
+		{name: "default config", opts: []ClientOption{WithTLSEnable()}, wantErr: true},
+		{name: "plain connection", wantErr: true},
+	}
+	for _, tt := range tests {
+		opts := append(tt.opts, WithDialTimeout(time.Second), WithReadTimeout(time.Second))
+		client := NewClient("tcp", addr, "", opts...)
+		_, err := client.Get(context.Background(), "test_key")
+		client.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expect error %v, got: %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	// rediss:// 连接串开启 TLS，WithTLS 指定的配置同样生效
+	client, err = NewClientFromURL("rediss://"+addr, WithTLS(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if v, err = client.Get(context.Background(), "test_key"); err != nil || v != "tls_ok" {
+		t.Errorf("Get over rediss url failed: %v, %v", v, err)
+	}
+}
+
+// 用户名应随 AUTH 命令发送至 redis
+func Test_ClientUsername(t *testing.T) {
+	authCh := make(chan []string, 1)
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.EqualFold(args[0], "AUTH") {
+			authCh <- args
+			return "+OK\r\n"
+		}
+		return "$-1\r\n"
+	})
+
+	client := NewClient("tcp", addr, "passwd", WithUsername("locker"))
+	defer client.Close()
+
+	if _, err := client.Get(context.Background(), "test_key"); !errors.Is(err, ErrNil) {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	select {
+	case args := <-authCh:
+		if len(args) != 3 || args[1] != "locker" || args[2] != "passwd" {
+			t.Errorf("unexpected AUTH args: %v", args)
+		}
+	default:
+		t.Error("AUTH was not sent")
+	}
+}
+
+// 连接串中的用户名、密码、逻辑库应在拨号时生效，非法连接串返回错误
+func Test_NewClientFromURL(t *testing.T) {
+	cmdCh := make(chan []string, 2)
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "AUTH", "SELECT":
+			cmdCh <- args
+			return "+OK\r\n"
+		}
+		return "$-1\r\n"
+	})
+
+	client, err := NewClientFromURL("redis://locker:passwd@" + addr + "/3")
+	if err != nil {
+		t.Fatalf("NewClientFromURL failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Get(context.Background(), "test_key"); !errors.Is(err, ErrNil) {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if auth := <-cmdCh; len(auth) != 3 || auth[1] != "locker" || auth[2] != "passwd" {
+		t.Errorf("unexpected AUTH args: %v", auth)
+	}
+	if sel := <-cmdCh; len(sel) != 2 || sel[1] != "3" {
+		t.Errorf("unexpected SELECT args: %v", sel)
+	}
+
+	for _, rawURL := range []string{"http://127.0.0.1:6379", "redis://", "redis://127.0.0.1:6379/db", "://bad"} {
+		if _, err := NewClientFromURL(rawURL); err == nil {
+			t.Errorf("NewClientFromURL(%q) should fail", rawURL)
+		}
+	}
+}
+
+// 非法参数应返回错误，而不是 panic
+func Test_ClientEmptyArgs(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient("tcp", "127.0.0.1:6379", "")
+	defer client.Close()
+
+	if _, err := client.Get(ctx, ""); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Get with empty key should return ErrEmptyKey, got: %v", err)
+	}
+	if _, err := client.Set(ctx, "test_key", "", 1); !errors.Is(err, ErrEmptyValue) {
+		t.Errorf("Set with empty value should return ErrEmptyValue, got: %v", err)
+	}
+	if _, err := client.SetNX(ctx, "", "token", 1); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("SetNX with empty key should return ErrEmptyKey, got: %v", err)
+	}
+	if err := client.Del(ctx, ""); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Del with empty key should return ErrEmptyKey, got: %v", err)
+	}
+	if _, err := client.Incr(ctx, ""); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Incr with empty key should return ErrEmptyKey, got: %v", err)
+	}
+
+	noAddrClient := NewClient("tcp", "", "")
+	defer noAddrClient.Close()
+	if _, err := noAddrClient.Get(ctx, "test_key"); !errors.Is(err, ErrEmptyAddress) {
+		t.Errorf("Get with empty address should return ErrEmptyAddress, got: %v", err)
+	}
+}
+
+// go-redis 适配器的返回值语义应与 redigo Client 一致
+func Test_GoRedisClient(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			// SET NX 失败
+			return "$-1\r\n"
+		case "GET":
+			return "$5\r\ntoken\r\n"
+		case "PTTL":
+			return ":-2\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
+	defer rdb.Close()
+	client := NewGoRedisClient(rdb)
+	ctx := context.Background()
+
+	if _, err := client.SetNX(ctx, "test_key", "token", 1); !errors.Is(err, ErrNil) {
+		t.Errorf("SetNX failure should return ErrNil, got: %v", err)
+	}
+	if v, err := client.Get(ctx, "test_key"); err != nil || v != "token" {
+		t.Errorf("unexpected Get result: %v, %v", v, err)
+	}
+	if ttl, err := client.PTTL(ctx, "test_key"); err != nil || ttl != -2 {
+		t.Errorf("unexpected PTTL result: %v, %v", ttl, err)
+	}
+}
+
+// 哨兵模式下应通过哨兵解析主节点地址后拨号
+func Test_SentinelClient(t *testing.T) {
+	masterAddr := startRedisMock(t, func(args []string) string {
+		return "$6\r\nmaster\r\n"
+	})
+	host, port, _ := net.SplitHostPort(masterAddr)
+	sentinelAddr := startRedisMock(t, func(args []string) string {
+		if strings.EqualFold(args[0], "SENTINEL") && args[2] == "mymaster" {
+			return fmt.Sprintf("*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		}
+		return "*-1\r\n"
+	})
+
+	client, err := NewSentinelClient("mymaster", []string{"127.0.0.1:1", sentinelAddr}, WithPoolWaitTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := client.Get(context.Background(), "test_key"); err != nil || v != "master" {
+		t.Errorf("unexpected Get result: %v, %v", v, err)
+	}
+	if client.poolWaitTimeout != 50*time.Millisecond {
+		t.Errorf("expect pool wait timeout kept, got: %v", client.poolWaitTimeout)
+	}
+	// 哨兵 Client 自己创建的连接池在 Close 时关闭
+	if err = client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conn := client.pool.Get()
+	if conn.Err() == nil {
+		t.Error("expect the pool closed after Close")
+	}
+	conn.Close()
+
+	if _, err := NewSentinelClient("", []string{sentinelAddr}); err == nil {
+		t.Error("NewSentinelClient without master name should fail")
+	}
+}
+
+// 哈希槽计算应与 redis cluster 一致，hash tag 内容相同的 key 位于同一槽位
+func Test_ClusterSlot(t *testing.T) {
+	cases := map[string]int{
+		"foo":       12182,
+		"123456789": 12739,
+		"{foo}bar":  12182,
+	}
+	for key, slot := range cases {
+		if got := ClusterSlot(key); got != slot {
+			t.Errorf("ClusterSlot(%q) = %d, want %d", key, got, slot)
+		}
+	}
+	if ClusterSlot("{user1000}.following") != ClusterSlot("{user1000}.followers") {
+		t.Error("keys with the same hash tag should map to the same slot")
+	}
+}
+
+// 收到 MOVED 重定向时，应在目标节点上重试
+func Test_ClusterClientMoved(t *testing.T) {
+	targetAddr := startRedisMock(t, func(args []string) string {
+		return "$6\r\ntarget\r\n"
+	})
+	seedAddr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "CLUSTER":
+			// 所有槽位都没有分配，依赖 MOVED 重定向
+			return "*0\r\n"
+		case "GET":
+			return fmt.Sprintf("-MOVED %d %s\r\n", ClusterSlot(args[1]), targetAddr)
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	client, err := NewClusterClient([]string{seedAddr}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if v, err := client.Get(context.Background(), "test_key"); err != nil || v != "target" {
+		t.Errorf("unexpected Get result: %v, %v", v, err)
+	}
+}
+
+// 启动一个 redis mock 服务，handler 根据命令参数返回 RESP 格式的响应
+func startRedisMock(t *testing.T, handler func(args []string) string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveRedisMock(t, ln, handler)
+}
+
+// 启动一个使用自签名证书的 TLS redis mock 服务，返回地址与信任该证书的证书池
+func startTLSRedisMock(t *testing.T, handler func(args []string) string) (string, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveRedisMock(t, ln, handler), roots
+}
+
+func serveRedisMock(t *testing.T, ln net.Listener, handler func(args []string) string) string {
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleRedisMockConn(conn, handler)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// 解析 RESP 数组形式的命令，PING 固定返回 PONG，其余命令交给 handler 处理
+func handleRedisMockConn(conn net.Conn, handler func(args []string) string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			if _, err = reader.ReadString('\n'); err != nil {
+				return
+			}
+			arg, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			args = append(args, strings.TrimSpace(arg))
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if strings.EqualFold(args[0], "PING") {
+			conn.Write([]byte("+PONG\r\n"))
+			continue
+		}
+		conn.Write([]byte(handler(args)))
+	}
+}
+
 func Test_blockingLock(t *testing.T) {
 	addr := "172.17.224.1:6379"
 	passwd := ""
@@ -91,6 +505,191 @@ func Test_WatchDog(t *testing.T) {
 	time.Sleep(2 * time.Second)
 }
 
+// 非看门狗模式下加锁后解锁，以及重复解锁，均不应 panic
+func Test_UnlockWithoutWatchDog(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	// 从未加锁成功的锁，直接解锁不应 panic
+	lock0 := NewRedisLock("test_unlock_key", client, WithExpireSeconds(5))
+	_ = lock0.Unlock(ctx)
+
+	lock1 := NewRedisLock("test_unlock_key", client, WithExpireSeconds(5))
+	if err := lock1.Lock(ctx); err != nil {
+		t.Errorf("lock1.Lock failed: %v", err)
+		return
+	}
+
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Errorf("lock1.Unlock failed: %v", err)
+		return
+	}
+
+	// 重复解锁，返回错误但不应 panic
+	if err := lock1.Unlock(ctx); err == nil {
+		t.Error("second Unlock should fail without ownership of lock")
+	}
+}
+
+// 续约后锁的剩余过期时间应被重置为续约时长，而不只是脚本返回成功
+func Test_DelayExpireTTL(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_delay_expire_key", client, WithExpireSeconds(2))
+	if err := lock.Lock(ctx); err != nil {
+		t.Errorf("lock.Lock failed: %v", err)
+		return
+	}
+	defer lock.Unlock(ctx)
+
+	time.Sleep(time.Second)
+	before, err := lock.TTL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = lock.DelayExpire(ctx, 5); err != nil {
+		t.Fatalf("lock.DelayExpire failed: %v", err)
+	}
+	after, err := lock.TTL(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before || after > 5*time.Second {
+		t.Errorf("ttl not reset by renewal, before: %v, after: %v", before, after)
+	}
+}
+
+// Lock 的 ctx 在 1s 后超时，看门狗仍应持续续约
+func Test_WatchDogDetachedFromLockCtx(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	lockCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	lock1 := NewRedisLock("test_detached_key", client)
+	if err := lock1.Lock(lockCtx); err != nil {
+		t.Errorf("lock1.Lock failed: %v", err)
+		return
+	}
+	defer lock1.Unlock(context.Background())
+
+	// 业务执行 10s，超过 Lock ctx 的超时时间；锁默认 10s 过期，只有持续续约才能继续持有
+	time.Sleep(10 * time.Second)
+
+	if ttl, err := lock1.TTL(context.Background()); err != nil {
+		t.Errorf("lock should still be held after lock ctx timeout, ttl: %v, err: %v", ttl, err)
+	}
+}
+
+// 读锁共享，写锁与读锁互斥
+func Test_RWLock(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	reader1 := NewRWRedisLock("test_rw_key", client, WithToken("reader1"), WithExpireSeconds(5))
+	reader2 := NewRWRedisLock("test_rw_key", client, WithToken("reader2"), WithExpireSeconds(5))
+	writer := NewRWRedisLock("test_rw_key", client, WithToken("writer"), WithExpireSeconds(5))
+
+	if err := reader1.RLock(ctx); err != nil {
+		t.Fatalf("reader1.RLock failed: %v", err)
+	}
+	if err := reader2.RLock(ctx); err != nil {
+		t.Fatalf("reader2.RLock failed: %v", err)
+	}
+	if err := writer.Lock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("writer.Lock should fail while readers hold the lock, got: %v", err)
+	}
+
+	_ = reader1.RUnlock(ctx)
+	_ = reader2.RUnlock(ctx)
+	if err := writer.Lock(ctx); err != nil {
+		t.Fatalf("writer.Lock failed: %v", err)
+	}
+	defer writer.Unlock(ctx)
+	if err := reader1.RLock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("reader1.RLock should fail while writer holds the lock, got: %v", err)
+	}
+}
+
+// 信号量最多允许 limit 个持有者
+func Test_Semaphore(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	sem1 := NewSemaphore("test_semaphore_key", 2, client, WithToken("holder1"), WithExpireSeconds(5))
+	sem2 := NewSemaphore("test_semaphore_key", 2, client, WithToken("holder2"), WithExpireSeconds(5))
+	sem3 := NewSemaphore("test_semaphore_key", 2, client, WithToken("holder3"), WithExpireSeconds(5))
+
+	if err := sem1.Acquire(ctx); err != nil {
+		t.Fatalf("sem1.Acquire failed: %v", err)
+	}
+	if err := sem2.Acquire(ctx); err != nil {
+		t.Fatalf("sem2.Acquire failed: %v", err)
+	}
+	if err := sem3.Acquire(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("sem3.Acquire should fail when semaphore is full, got: %v", err)
+	}
+
+	_ = sem1.Release(ctx)
+	if err := sem3.Acquire(ctx); err != nil {
+		t.Errorf("sem3.Acquire failed after release: %v", err)
+	}
+	_ = sem2.Release(ctx)
+	_ = sem3.Release(ctx)
+}
+
+// 公平锁模式下，锁释放后只有队首的等锁方可以取锁
+func Test_FairQueueLock(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_fair_key", client, WithToken("lock1"), WithExpireSeconds(5), WithFairQueue())
+	lock2 := NewRedisLock("test_fair_key", client, WithToken("lock2"), WithExpireSeconds(5), WithFairQueue(), WithBlock())
+	lock3 := NewRedisLock("test_fair_key", client, WithToken("lock3"), WithExpireSeconds(5), WithFairQueue())
+
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatalf("lock1.Lock failed: %v", err)
+	}
+
+	// lock2 先进入等锁队列
+	done := make(chan error, 1)
+	go func() {
+		done <- lock2.Lock(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatalf("lock1.Unlock failed: %v", err)
+	}
+	// lock3 后到，不能插队
+	if acquired, err := lock3.TryLock(ctx); acquired || err != nil {
+		t.Errorf("lock3 should not jump the queue, acquired: %v, err: %v", acquired, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("lock2.Lock failed: %v", err)
+	}
+	_ = lock2.Unlock(ctx)
+}
+
 func Test_redLock(t *testing.T) {
 	// 请输入三个 redis 节点的地址和密码
 	addr1 := "xxxx:xx"
@@ -140,3 +739,3237 @@ func Test_redLock(t *testing.T) {
 
 	t.Log("success")
 }
+
+// 红锁所有节点上的锁应使用同一个 token
+func Test_redLockSharedToken(t *testing.T) {
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: "127.0.0.1:6379"},
+		{Network: "tcp", Address: "127.0.0.1:6380"},
+		{Network: "tcp", Address: "127.0.0.1:6381"},
+	}
+
+	redLock, err := NewRedLock("test_key", confs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redLock.Close()
+
+	token := redLock.locks[0].token
+	for i, lock := range redLock.locks {
+		if lock.token != token {
+			t.Errorf("node %d token %s differs from %s", i, lock.token, token)
+		}
+	}
+}
+
+// 锁被他人持有时，错误应可通过 errors.Is 判断，且不包含格式化占位符错误
+func Test_tryLockHeldByOthers(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "SET" {
+			return "$-1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5))
+	err := lock.Lock(context.Background())
+	if !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Fatalf("expect ErrLockAcquiredByOthers, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "%!") {
+		t.Errorf("malformed error message: %s", err)
+	}
+}
+
+type testMetrics struct {
+	mu          sync.Mutex
+	acquires    []bool
+	contentions int
+	unlocks     []bool
+}
+
+func (m *testMetrics) OnAcquire(success bool, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acquires = append(m.acquires, success)
+}
+
+func (m *testMetrics) OnRenew(bool) {}
+
+func (m *testMetrics) OnContention() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.contentions++
+}
+
+func (m *testMetrics) OnUnlock(success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unlocks = append(m.unlocks, success)
+}
+
+// 阻塞取锁时每次竞争失败触发 OnContention，取锁、解锁结束各触发一次回调
+func Test_LockMetrics(t *testing.T) {
+	var setCnt int32
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			// 前两次 SET NX 失败，第三次成功
+			if atomic.AddInt32(&setCnt, 1) <= 2 {
+				return "$-1\r\n"
+			}
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	metrics := &testMetrics{}
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5), WithBlock(), WithPollInterval(time.Millisecond), WithMetrics(metrics))
+	if err := lock.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.contentions != 2 {
+		t.Errorf("expect 2 contentions, got: %d", metrics.contentions)
+	}
+	if len(metrics.acquires) != 1 || !metrics.acquires[0] {
+		t.Errorf("expect one successful acquire, got: %v", metrics.acquires)
+	}
+	if len(metrics.unlocks) != 1 || !metrics.unlocks[0] {
+		t.Errorf("expect one successful unlock, got: %v", metrics.unlocks)
+	}
+}
+
+// WithLock 在 fn 返回错误或 panic 时都应解锁
+func Test_WithLock(t *testing.T) {
+	var unlockCnt int32
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			atomic.AddInt32(&unlockCnt, 1)
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5))
+
+	fnErr := errors.New("fn failed")
+	err := lock.WithLock(context.Background(), func(ctx context.Context) error {
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) {
+		t.Errorf("expect fn error, got: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expect panic to propagate")
+			}
+		}()
+		_ = lock.WithLock(context.Background(), func(ctx context.Context) error {
+			panic("fn panic")
+		})
+	}()
+
+	if cnt := atomic.LoadInt32(&unlockCnt); cnt != 2 {
+		t.Errorf("expect unlock called 2 times, got: %d", cnt)
+	}
+}
+
+// 同一实例在多个协程间并发 Lock/Unlock/Extend，需配合 go test -race 运行
+func Test_ConcurrentLockUnlock(t *testing.T) {
+	var mu sync.Mutex
+	var holder string
+	addr := startRedisMock(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			if holder != "" {
+				return "$-1\r\n"
+			}
+			holder = args[2]
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			// 解锁与续约脚本均简化为：持有锁时成功
+			if holder == "" {
+				return ":0\r\n"
+			}
+			if len(args) > 5 {
+				return ":" + args[5] + "\r\n"
+			}
+			holder = ""
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client, WithWatchDogInterval(time.Millisecond), WithBlock(), WithPollInterval(time.Millisecond))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := lock.Lock(context.Background()); err != nil {
+					continue
+				}
+				_ = lock.Extend(context.Background(), time.Second)
+				_ = lock.Errors()
+				_ = lock.Unlock(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Set 在 expireSeconds > 0 时应携带 EX，Exists 返回 key 是否存在
+func Test_ClientSetAndExists(t *testing.T) {
+	var mu sync.Mutex
+	var setArgs []string
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			mu.Lock()
+			setArgs = args
+			mu.Unlock()
+			return "+OK\r\n"
+		case "EXISTS":
+			if args[1] == "test_key" {
+				return ":1\r\n"
+			}
+			return ":0\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	if reply, err := client.Set(ctx, "test_key", "value", 2); err != nil || reply != 1 {
+		t.Fatalf("Set failed, reply: %d, err: %v", reply, err)
+	}
+	mu.Lock()
+	if got := strings.Join(setArgs, " "); got != "SET test_key value EX 2" {
+		t.Errorf("unexpected SET command: %s", got)
+	}
+	mu.Unlock()
+
+	if _, err := client.Set(ctx, "test_key", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if got := strings.Join(setArgs, " "); got != "SET test_key value" {
+		t.Errorf("unexpected SET command without expire: %s", got)
+	}
+	mu.Unlock()
+
+	if exists, err := client.Exists(ctx, "test_key"); err != nil || !exists {
+		t.Errorf("Exists(test_key) = %v, %v, expect true", exists, err)
+	}
+	if exists, err := client.Exists(ctx, "missing_key"); err != nil || exists {
+		t.Errorf("Exists(missing_key) = %v, %v, expect false", exists, err)
+	}
+	if _, err := client.Exists(ctx, ""); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("Exists with empty key should return ErrEmptyKey, got: %v", err)
+	}
+}
+
+// Decr/IncrBy/DecrBy 返回执行后的值，允许为负数
+func Test_ClientIncrDecr(t *testing.T) {
+	var mu sync.Mutex
+	var value int64
+	addr := startRedisMock(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "DECR":
+			value--
+		case "INCRBY":
+			n, _ := strconv.ParseInt(args[2], 10, 64)
+			value += n
+		case "DECRBY":
+			n, _ := strconv.ParseInt(args[2], 10, 64)
+			value -= n
+		default:
+			return "-ERR unknown command\r\n"
+		}
+		return ":" + strconv.FormatInt(value, 10) + "\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	if v, err := client.Decr(ctx, "test_key"); err != nil || v != -1 {
+		t.Errorf("Decr = %d, %v, expect -1", v, err)
+	}
+	if v, err := client.DecrBy(ctx, "test_key", 5); err != nil || v != -6 {
+		t.Errorf("DecrBy = %d, %v, expect -6", v, err)
+	}
+	if v, err := client.IncrBy(ctx, "test_key", 10); err != nil || v != 4 {
+		t.Errorf("IncrBy = %d, %v, expect 4", v, err)
+	}
+	if v, err := client.IncrBy(ctx, "test_key", -7); err != nil || v != -3 {
+		t.Errorf("IncrBy with negative n = %d, %v, expect -3", v, err)
+	}
+	if _, err := client.DecrBy(ctx, "", 1); !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("DecrBy with empty key should return ErrEmptyKey, got: %v", err)
+	}
+}
+
+// 阻塞模式下重试次数用尽后返回 ErrLockAcquiredByOthers
+func Test_MaxRetries(t *testing.T) {
+	var setCnt int32
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "SET" {
+			atomic.AddInt32(&setCnt, 1)
+			return "$-1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5), WithBlock(), WithPollInterval(time.Millisecond), WithMaxRetries(3))
+	if err := lock.Lock(context.Background()); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Fatalf("expect ErrLockAcquiredByOthers, got: %v", err)
+	}
+	// 首次取锁 + 3 次重试
+	if cnt := atomic.LoadInt32(&setCnt); cnt != 4 {
+		t.Errorf("expect 4 attempts, got: %d", cnt)
+	}
+}
+
+// 指数退避的轮询间隔逐次增长，且不超过上限；随机抖动至多减少一半
+func Test_BackoffInterval(t *testing.T) {
+	var o LockOptions
+	WithBackoff(10*time.Millisecond, 80*time.Millisecond, 2)(&o)
+	repairLock(&o)
+
+	for retries, expect := range []time.Duration{10, 20, 40, 80, 80, 80} {
+		expect *= time.Millisecond
+		got := o.nextPollInterval(retries)
+		if got > expect || got < expect/2 {
+			t.Errorf("retries %d: expect interval in [%v, %v], got: %v", retries, expect/2, expect, got)
+		}
+	}
+
+	// 未设置指数退避时保持固定的轮询间隔
+	var fixed LockOptions
+	repairLock(&fixed)
+	if got := fixed.nextPollInterval(10); got != DefaultPollInterval {
+		t.Errorf("expect fixed interval %v, got: %v", DefaultPollInterval, got)
+	}
+}
+
+// 看门狗的父 ctx 结束时，看门狗停止续约并关闭错误通道
+func Test_WatchDogContext(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	appCtx, appCancel := context.WithCancel(context.Background())
+	lock := NewRedisLock("test_key", client, WithWatchDogInterval(10*time.Millisecond), WithWatchDogContext(appCtx))
+	if err := lock.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	errCh := lock.Errors()
+	appCancel()
+
+	select {
+	case _, ok := <-errCh:
+		for ok {
+			_, ok = <-errCh
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watchdog should stop after its parent ctx is done")
+	}
+}
+
+// Ping 检查连通性，HealthCheck 返回红锁各节点的健康状态
+func Test_PingAndHealthCheck(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	if err := client.Ping(context.Background()); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: addr},
+		{Network: "tcp", Address: "127.0.0.1:1"},
+	}
+	redLock, err := NewRedLock("test_key", confs, WithSingleNodesTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redLock.Close()
+
+	statuses := redLock.HealthCheck(context.Background())
+	if len(statuses) != 2 {
+		t.Fatalf("expect 2 node statuses, got: %d", len(statuses))
+	}
+	if statuses[0].Address != addr || statuses[0].Err != nil {
+		t.Errorf("node 0 should be healthy, got: %+v", statuses[0])
+	}
+	if statuses[1].Err == nil {
+		t.Errorf("node 1 should be unhealthy, got: %+v", statuses[1])
+	}
+}
+
+// 加锁成功后 Deadline 返回加锁时间 + 过期时间，解锁后清空
+func Test_Deadline(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5))
+	if deadline, _ := lock.Deadline(); !deadline.IsZero() {
+		t.Errorf("deadline should be zero before Lock, got: %v", deadline)
+	}
+
+	begin := time.Now()
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline, watchDog := lock.Deadline()
+	if watchDog {
+		t.Error("lock with explicit expire should not be managed by watchdog")
+	}
+	if deadline.Before(begin.Add(5*time.Second)) || deadline.After(time.Now().Add(5*time.Second)) {
+		t.Errorf("unexpected deadline: %v", deadline)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if deadline, _ = lock.Deadline(); !deadline.IsZero() {
+		t.Errorf("deadline should be zero after Unlock, got: %v", deadline)
+	}
+}
+
+// 默认日志组件以 "msg key=value" 的格式输出结构化日志，并按级别过滤
+func Test_LoggerFormat(t *testing.T) {
+	var buf strings.Builder
+	l := newWriterLogger(&buf, LevelInfo, 0)
+
+	l.Debug("debug msg", "key", "k")
+	l.Info("看门狗启动", "key", "test_key", "interval", 3*time.Second)
+	l.Error("odd args", "err")
+
+	expect := "[Info]: 看门狗启动 key=test_key interval=3s\n[Error]: odd args err=<missing>\n"
+	if buf.String() != expect {
+		t.Errorf("unexpected log output:\n%s\nexpect:\n%s", buf.String(), expect)
+	}
+}
+
+// 创建时检查节点连通性：可达节点不少于 quorum 时创建成功，不可达节点被标记为下线
+func Test_redLockPingOnCreate(t *testing.T) {
+	addr1 := startRedisMock(t, func(args []string) string { return "-ERR unknown command\r\n" })
+	addr2 := startRedisMock(t, func(args []string) string { return "-ERR unknown command\r\n" })
+	dead := "127.0.0.1:1"
+
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: addr1},
+		{Network: "tcp", Address: addr2},
+		{Network: "tcp", Address: dead},
+	}
+	redLock, err := NewRedLock("test_key", confs, WithSingleNodesTimeout(time.Second), WithPingOnCreate())
+	if err != nil {
+		t.Fatalf("redLock with a quorum of healthy nodes should be created, got: %v", err)
+	}
+	defer redLock.Close()
+	if redLock.isDown(0) || redLock.isDown(1) || !redLock.isDown(2) {
+		t.Errorf("unexpected down marks: %v", redLock.down)
+	}
+
+	confs = []*SingleNodeConf{
+		{Network: "tcp", Address: addr1},
+		{Network: "tcp", Address: dead},
+		{Network: "tcp", Address: dead},
+	}
+	if _, err = NewRedLock("test_key", confs, WithSingleNodesTimeout(time.Second), WithPingOnCreate()); err == nil {
+		t.Error("redLock without a quorum of healthy nodes should fail")
+	}
+}
+
+// 显式指定 <= 0 的过期时间返回 ErrInvalidExpire，而不是退化为看门狗模式
+func Test_InvalidExpire(t *testing.T) {
+	client := NewClient("tcp", "127.0.0.1:1", "")
+	defer client.Close()
+	ctx := context.Background()
+
+	for _, opt := range []LockOption{WithExpireSeconds(0), WithExpireSeconds(-1), WithExpireDuration(0)} {
+		lock := NewRedisLock("test_key", client, opt)
+		if lock.watchDogMode {
+			t.Error("invalid expire should not enable watchdog")
+		}
+		if err := lock.Lock(ctx); !errors.Is(err, ErrInvalidExpire) {
+			t.Errorf("Lock should return ErrInvalidExpire, got: %v", err)
+		}
+		if _, err := lock.TryLock(ctx); !errors.Is(err, ErrInvalidExpire) {
+			t.Errorf("TryLock should return ErrInvalidExpire, got: %v", err)
+		}
+	}
+
+	// 未指定过期时间时启动看门狗
+	if lock := NewRedisLock("test_key", client); !lock.watchDogMode || lock.err != nil {
+		t.Errorf("lock without expire should enable watchdog, watchDogMode: %v, err: %v", lock.watchDogMode, lock.err)
+	}
+}
+
+// 开启 WithOwnerDiagnostics 时，取锁失败返回包含当前持有者的 LockHeldError
+func Test_LockHeldError(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			return "$6\r\nowner1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5), WithOwnerDiagnostics())
+	err := lock.Lock(context.Background())
+	if !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Fatalf("expect ErrLockAcquiredByOthers, got: %v", err)
+	}
+	var heldErr *LockHeldError
+	if !errors.As(err, &heldErr) || heldErr.Owner != "owner1" {
+		t.Errorf("expect LockHeldError with owner owner1, got: %v", err)
+	}
+
+	// 阻塞模式下重试次数用尽、等锁超时，返回的错误中保留持有者
+	for _, opt := range []LockOption{WithMaxRetries(2), WithBlockWaitingSeconds(1)} {
+		lock = NewRedisLock("test_key", client, WithExpireSeconds(5), WithOwnerDiagnostics(), WithBlock(), WithPollInterval(10*time.Millisecond), opt)
+		err = lock.Lock(context.Background())
+		heldErr = nil
+		if !errors.Is(err, ErrLockAcquiredByOthers) || !errors.As(err, &heldErr) || heldErr.Owner != "owner1" {
+			t.Errorf("expect LockHeldError with owner owner1 after blocking, got: %v", err)
+		}
+	}
+}
+
+// WithExpireAt 以剩余时间作为过期时间、不启动看门狗，过期时刻已过时返回 ErrExpireAtPassed
+func Test_ExpireAt(t *testing.T) {
+	var mu sync.Mutex
+	var setArgs []string
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "SET" {
+			mu.Lock()
+			setArgs = args
+			mu.Unlock()
+			return "+OK\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithExpireAt(time.Now().Add(2*time.Second)))
+	if lock.watchDogMode {
+		t.Error("WithExpireAt should disable watchdog")
+	}
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	// SET key token PX ms NX，剩余时间恰为整秒时为 EX
+	if len(setArgs) != 6 || (setArgs[3] != "PX" && setArgs[3] != "EX") {
+		t.Fatalf("unexpected SET command: %v", setArgs)
+	}
+	px, _ := strconv.ParseInt(setArgs[4], 10, 64)
+	if setArgs[3] == "EX" {
+		px *= 1000
+	}
+	mu.Unlock()
+	if px <= 0 || px > 2000 {
+		t.Errorf("expect remaining ttl in (0, 2000]ms, got: %d", px)
+	}
+
+	expired := NewRedisLock("test_key", client, WithExpireAt(time.Now().Add(-time.Second)))
+	if err := expired.Lock(ctx); !errors.Is(err, ErrExpireAtPassed) {
+		t.Errorf("expect ErrExpireAtPassed, got: %v", err)
+	}
+}
+
+// 连接池耗尽时触发 poolWaitHook，Stats 反映连接池中的连接数
+func Test_ClientPoolStats(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		return "+OK\r\n"
+	})
+	var hookErr error
+	var hookCnt int32
+	client := NewClient("tcp", addr, "", WithMaxActive(1), WithMaxIdle(1), WithPoolWaitHook(func(wait time.Duration, err error) {
+		atomic.AddInt32(&hookCnt, 1)
+		hookErr = err
+	}))
+	defer client.Close()
+	ctx := context.Background()
+
+	conn, err := client.getConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.Stats(); stats.ActiveCount != 1 || stats.IdleCount != 0 {
+		t.Errorf("unexpected stats with one connection in use: %+v", stats)
+	}
+
+	// 非 Wait 模式下连接池耗尽，获取连接失败
+	if _, err = client.Get(ctx, "test_key"); err == nil {
+		t.Error("Get should fail when pool is exhausted")
+	}
+	if atomic.LoadInt32(&hookCnt) != 1 || !errors.Is(hookErr, redis.ErrPoolExhausted) {
+		t.Errorf("expect hook called once with ErrPoolExhausted, got: %d, %v", hookCnt, hookErr)
+	}
+
+	conn.Close()
+	if stats := client.Stats(); stats.ActiveCount != 1 || stats.IdleCount != 1 {
+		t.Errorf("unexpected stats after connection returned: %+v", stats)
+	}
+}
+
+// 解锁与看门狗续约交错时，解锁后看门狗不应再上报续约失败
+func Test_UnlockInterleavedWithRenewal(t *testing.T) {
+	var mu sync.Mutex
+	var holder string
+	addr := startRedisMock(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			if holder != "" {
+				return "$-1\r\n"
+			}
+			holder = args[2]
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			if holder == "" {
+				return ":0\r\n"
+			}
+			// 续约脚本返回续约时长，解锁脚本删除锁
+			if len(args) > 5 {
+				return ":" + args[5] + "\r\n"
+			}
+			holder = ""
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithWatchDogInterval(time.Millisecond))
+	for i := 0; i < 200; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		errCh := lock.Errors()
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for err := range errCh {
+			t.Fatalf("round %d: unexpected renewal error after unlock: %v", i, err)
+		}
+	}
+}
+
+func Test_MultiLock(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	lockA := NewMultiLock([]string{"test_multi_b", "test_multi_a", "test_multi_c"}, client, WithToken("a"), WithExpireSeconds(5))
+	lockB := NewMultiLock([]string{"test_multi_d", "test_multi_c"}, client, WithToken("b"), WithExpireSeconds(5))
+
+	if err := lockA.Lock(ctx); err != nil {
+		t.Fatalf("lockA.Lock failed: %v", err)
+	}
+	if err := lockB.Lock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("lockB.Lock should fail while lockA holds test_multi_c, got: %v", err)
+	}
+	if err := lockB.LockAtomic(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("lockB.LockAtomic should fail while lockA holds test_multi_c, got: %v", err)
+	}
+	// 原子加锁失败时不应锁定任何 key
+	if _, err := client.Get(ctx, RedisLockKeyPrefix+"test_multi_d"); err == nil {
+		t.Errorf("test_multi_d should not be locked after a failed atomic lock")
+	}
+
+	if err := lockA.Unlock(ctx); err != nil {
+		t.Fatalf("lockA.Unlock failed: %v", err)
+	}
+	if err := lockB.LockAtomic(ctx); err != nil {
+		t.Fatalf("lockB.LockAtomic failed: %v", err)
+	}
+	if err := lockB.Unlock(ctx); err != nil {
+		t.Fatalf("lockB.Unlock failed: %v", err)
+	}
+}
+
+func Test_WithClientPool(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "GET" {
+			return "$5\r\nvalue\r\n"
+		}
+		return "+OK\r\n"
+	})
+	pool := &redis.Pool{
+		MaxIdle: 1,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}
+	defer pool.Close()
+
+	client := NewClient("tcp", "", "", WithClientPool(pool))
+	ctx := context.Background()
+	if val, err := client.Get(ctx, "test_key"); err != nil || val != "value" {
+		t.Fatalf("Get through the external pool failed: %q, %v", val, err)
+	}
+
+	// 关闭 Client 不应关闭外部传入的连接池
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ctx, "test_key"); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expect ErrClientClosed after Close, got: %v", err)
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Errorf("external pool should still be usable after client.Close, got: %v", err)
+	}
+}
+
+func Test_WatchDogIntervalAdjust(t *testing.T) {
+	var buf strings.Builder
+	var o LockOptions
+	WithLogger(newWriterLogger(&buf, LevelInfo, 0))(&o)
+	WithWatchDogInterval(20 * time.Second)(&o)
+	repairLock(&o)
+
+	if !o.watchDogMode {
+		t.Fatal("expect watchdog mode")
+	}
+	if o.watchDogInterval >= o.expireDuration {
+		t.Errorf("expect interval shorter than expire %v, got: %v", o.expireDuration, o.watchDogInterval)
+	}
+	if !strings.Contains(buf.String(), "adjusted_interval") {
+		t.Errorf("expect a warning logged when adjusting interval, got: %q", buf.String())
+	}
+
+	// 合法的续约间隔保持不变
+	var valid LockOptions
+	WithWatchDogInterval(time.Second)(&valid)
+	repairLock(&valid)
+	if valid.watchDogInterval != time.Second {
+		t.Errorf("expect interval unchanged, got: %v", valid.watchDogInterval)
+	}
+}
+
+func Test_Transfer(t *testing.T) {
+	addr := "172.17.224.1:6379"
+	passwd := ""
+
+	client := NewClient("tcp", addr, passwd)
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_transfer_key", client, WithToken("worker1"), WithExpireSeconds(5))
+	lock2 := NewRedisLock("test_transfer_key", client, WithToken("worker2"), WithExpireSeconds(5))
+
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatalf("lock1.Lock failed: %v", err)
+	}
+	if err := lock1.Transfer(ctx, "worker2"); err != nil {
+		t.Fatalf("lock1.Transfer failed: %v", err)
+	}
+	if owned, _ := lock1.IsHeldByMe(ctx); owned {
+		t.Error("lock1 should not hold the lock after transfer")
+	}
+	if ttl, err := lock2.TTL(ctx); err != nil || ttl <= 0 {
+		t.Errorf("lock2 should hold the lock with ttl preserved, got: %v, %v", ttl, err)
+	}
+	if err := lock1.Transfer(ctx, "worker1"); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld when transferring a lock not held, got: %v", err)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Errorf("lock2.Unlock failed: %v", err)
+	}
+}
+
+func Test_redLockExtendWithValidity(t *testing.T) {
+	var held int32 = 1
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			// 续约脚本返回续约后的剩余过期时间(毫秒)，0 代表不再持有锁
+			if atomic.LoadInt32(&held) == 1 {
+				return ":5000\r\n"
+			}
+			return ":0\r\n"
+		}
+		return "+OK\r\n"
+	})
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: addr},
+		{Network: "tcp", Address: addr},
+		{Network: "tcp", Address: addr},
+	}
+	redLock, err := NewRedLock("test_key", confs, WithRedLockExpireDuration(5*time.Second), WithSingleNodesTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redLock.Close()
+	ctx := context.Background()
+
+	validity, err := redLock.ExtendWithValidity(ctx)
+	if err != nil {
+		t.Fatalf("ExtendWithValidity failed: %v", err)
+	}
+	if validity <= 0 || validity > 5*time.Second {
+		t.Errorf("expect validity in (0, 5s], got: %v", validity)
+	}
+
+	atomic.StoreInt32(&held, 0)
+	if _, err = redLock.ExtendWithValidity(ctx); err == nil {
+		t.Error("ExtendWithValidity should fail when no node holds the lock")
+	}
+}
+
+func Test_EvalContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			// 模拟执行缓慢的脚本
+			<-release
+			return ":1\r\n"
+		}
+		return "+OK\r\n"
+	})
+	defer close(release)
+	client := NewClient("tcp", addr, "", WithMaxIdle(1))
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	begin := time.Now()
+	_, err := client.Eval(ctx, LuaCheckOwnership, 1, []interface{}{"test_key", "token"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect context.Canceled, got: %v", err)
+	}
+	if cost := time.Since(begin); cost > time.Second {
+		t.Errorf("Eval should return promptly after ctx cancelled, cost: %v", cost)
+	}
+	// 被取消的连接不应归还连接池复用
+	if stats := client.Stats(); stats.IdleCount != 0 {
+		t.Errorf("cancelled connection should be discarded, got stats: %+v", stats)
+	}
+}
+
+func Test_OwnershipMonitor(t *testing.T) {
+	var stolen int32
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "GET":
+			// 模拟锁过期后被他人取得
+			if atomic.LoadInt32(&stolen) == 1 {
+				return "$5\r\nother\r\n"
+			}
+			return "$2\r\nme\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client, WithToken("me"), WithExpireSeconds(1), WithOwnershipMonitor(10*time.Millisecond))
+	var lost int32
+	err := lock.WithLock(context.Background(), func(ctx context.Context) error {
+		time.Sleep(30 * time.Millisecond)
+		if ctx.Err() != nil {
+			t.Error("ctx should not be cancelled while the lock is held")
+		}
+		atomic.StoreInt32(&stolen, 1)
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&lost, 1)
+		case <-time.After(time.Second):
+		}
+		return nil
+	})
+	if atomic.LoadInt32(&lost) != 1 {
+		t.Error("ctx should be cancelled after the lock is lost")
+	}
+	if !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld from Unlock, got: %v", err)
+	}
+}
+
+func Test_redLockUnlockSlowNode(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	newNode := func(slow bool) string {
+		return startRedisMock(t, func(args []string) string {
+			switch strings.ToUpper(args[0]) {
+			case "SCRIPT":
+				return "$3\r\nsha\r\n"
+			case "EVALSHA":
+				// 模拟卡住的节点
+				if slow {
+					<-release
+				}
+				return ":1\r\n"
+			}
+			return "+OK\r\n"
+		})
+	}
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: newNode(true)},
+		{Network: "tcp", Address: newNode(false)},
+		{Network: "tcp", Address: newNode(false)},
+	}
+	redLock, err := NewRedLock("test_key", confs, WithRedLockExpireDuration(5*time.Second), WithSingleNodesTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redLock.Close()
+
+	begin := time.Now()
+	if err = redLock.Unlock(context.Background()); err != nil {
+		t.Errorf("Unlock should succeed on the majority, got: %v", err)
+	}
+	if cost := time.Since(begin); cost > time.Second {
+		t.Errorf("slow node should not delay Unlock, cost: %v", cost)
+	}
+}
+
+func Test_NoWatchDog(t *testing.T) {
+	var o LockOptions
+	WithNoWatchDog()(&o)
+	repairLock(&o)
+	if o.watchDogMode {
+		t.Error("watchdog should be disabled by WithNoWatchDog")
+	}
+	if o.expireDuration != DefaultLockExpireSeconds*time.Second {
+		t.Errorf("expect default expire %v, got: %v", DefaultLockExpireSeconds*time.Second, o.expireDuration)
+	}
+
+	// 未指定过期时间且未关闭看门狗时，仍启用看门狗
+	var dog LockOptions
+	repairLock(&dog)
+	if !dog.watchDogMode {
+		t.Error("watchdog should be enabled without an explicit expire")
+	}
+}
+
+func Test_ImmediateRenewal(t *testing.T) {
+	renewed := make(chan struct{}, 1)
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			select {
+			case renewed <- struct{}{}:
+			default:
+			}
+			return ":1000\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client, WithImmediateRenewal())
+	if err := lock.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer lock.stopWatchDog()
+
+	// 默认续约间隔为 3 秒，1 秒内的续约只可能来自启动后的立即续约
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Error("expect a renewal right after Lock succeeds")
+	}
+}
+
+func Test_CustomScripts(t *testing.T) {
+	const (
+		acquireScript = "return redis.call('set',KEYS[1],ARGV[1],'px',ARGV[2],'nx') and 1 or 0"
+		releaseScript = "return redis.call('del',KEYS[1])"
+		renewScript   = "redis.call('pexpire',KEYS[1],ARGV[2]) return redis.call('pttl',KEYS[1])"
+	)
+	var mu sync.Mutex
+	loaded := make(map[string]bool)
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SCRIPT":
+			mu.Lock()
+			loaded[args[2]] = true
+			mu.Unlock()
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			return ":1\r\n"
+		}
+		return "-ERR unexpected command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(5),
+		WithAcquireScript(acquireScript), WithReleaseScript(releaseScript), WithRenewScript(renewScript))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock with custom acquire script failed: %v", err)
+	}
+	if err := lock.Extend(ctx, time.Second); err != nil {
+		t.Fatalf("Extend with custom renew script failed: %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock with custom release script failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, script := range []string{acquireScript, releaseScript, renewScript} {
+		if !loaded[script] {
+			t.Errorf("custom script not used: %s", script)
+		}
+	}
+}
+
+func Test_KeyPrefix(t *testing.T) {
+	client := NewClient("tcp", "127.0.0.1:1", "")
+	defer client.Close()
+
+	lock := NewRedisLock("test_key", client)
+	if key := lock.getLockKey(); key != RedisLockKeyPrefix+"test_key" {
+		t.Errorf("expect default prefix, got: %s", key)
+	}
+	lock = NewRedisLock("test_key", client, WithKeyPrefix("svc-orders:"))
+	if key := lock.getLockKey(); key != "svc-orders:test_key" {
+		t.Errorf("expect custom prefix, got: %s", key)
+	}
+}
+
+func Test_NewRedLockWithClients(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			return ":1\r\n"
+		}
+		return "+OK\r\n"
+	})
+	var clients []LockClient
+	for i := 0; i < 3; i++ {
+		client := NewClient("tcp", addr, "")
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	redLock, err := NewRedLockWithClients("test_key", clients, WithRedLockExpireDuration(5*time.Second), WithSingleNodesTimeout(100*time.Millisecond), WithPingOnCreate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = redLock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err = redLock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	// 关闭红锁不应关闭调用方传入的客户端
+	if err = redLock.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = clients[0].(*Client).Ping(ctx); err != nil {
+		t.Errorf("client should still be usable after redLock.Close, got: %v", err)
+	}
+}
+
+func Test_GetMissingKey(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.EqualFold(args[0], "GET") && args[1] == RedisLockKeyPrefix+"present_key" {
+			return "$5\r\ntoken\r\n"
+		}
+		return "$-1\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	if v, err := client.Get(ctx, RedisLockKeyPrefix+"present_key"); err != nil || v != "token" {
+		t.Errorf("Get present key failed: %q, %v", v, err)
+	}
+	_, err := client.Get(ctx, RedisLockKeyPrefix+"absent_key")
+	if !errors.Is(err, ErrKeyNotFound) || !errors.Is(err, ErrNil) {
+		t.Errorf("expect ErrKeyNotFound (matching ErrNil) for absent key, got: %v", err)
+	}
+
+	if owned, err := NewRedisLock("present_key", client, WithToken("token")).IsHeldByMe(ctx); err != nil || !owned {
+		t.Errorf("expect present key held by me, got: %v, %v", owned, err)
+	}
+	if owned, err := NewRedisLock("absent_key", client, WithToken("token")).IsHeldByMe(ctx); err != nil || owned {
+		t.Errorf("expect absent key not held without error, got: %v, %v", owned, err)
+	}
+}
+
+func Test_RenewJitter(t *testing.T) {
+	var o LockOptions
+	WithWatchDogInterval(time.Second)(&o)
+	WithRenewJitter(time.Hour)(&o)
+	repairLock(&o)
+	if o.renewJitter != time.Second {
+		t.Errorf("expect jitter capped at the interval, got: %v", o.renewJitter)
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		d := o.renewExpireDuration()
+		if d < 2*time.Second || d >= 3*time.Second {
+			t.Fatalf("expect renewal duration in [2s, 3s), got: %v", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Error("expect renewal durations to be jittered")
+	}
+}
+
+func Test_sendErrDropPolicy(t *testing.T) {
+	e1, e2, e3 := errors.New("e1"), errors.New("e2"), errors.New("e3")
+	for _, c := range []struct {
+		policy DropPolicy
+		expect []error
+	}{
+		{DropNewest, []error{e1, e2}},
+		{DropOldest, []error{e2, e3}},
+	} {
+		errCh := make(chan error, 2)
+		for _, err := range []error{e1, e2, e3} {
+			sendErr(errCh, err, c.policy)
+		}
+		close(errCh)
+		var got []error
+		for err := range errCh {
+			got = append(got, err)
+		}
+		if len(got) != len(c.expect) || got[0] != c.expect[0] || got[1] != c.expect[1] {
+			t.Errorf("policy %d: expect %v, got: %v", c.policy, c.expect, got)
+		}
+	}
+}
+
+func Test_ErrorsLifecycle(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			// 续约总是失败，使错误通道持续收到错误；解锁总是成功
+			return ":0\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := NewClient("tcp", addr, "", WithMaxIdle(10))
+	defer client.Close()
+	ctx := context.Background()
+	baseline := runtime.NumGoroutine()
+
+	lock := NewRedisLock("test_key", client, WithWatchDogInterval(time.Millisecond), WithErrorsBuffer(4, DropOldest))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := lock.Lock(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+				// 读取方与续约、解锁并发，通道关闭后读取立即结束
+				go func(errCh <-chan error) {
+					for range errCh {
+					}
+				}(lock.Errors())
+				time.Sleep(time.Millisecond)
+				_ = lock.Unlock(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errCh := lock.Errors(); errCh != nil {
+		select {
+		case _, ok := <-errCh:
+			for ok {
+				_, ok = <-errCh
+			}
+		case <-time.After(time.Second):
+			t.Error("error channel should be closed after Unlock")
+		}
+	}
+	// 看门狗与读取协程均应退出；关闭客户端，使 mock 服务端处理空闲连接的协程退出
+	client.Close()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline+2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline+2 {
+		t.Errorf("goroutine leak: baseline %d, now %d", baseline, n)
+	}
+}
+
+func Test_Metadata(t *testing.T) {
+	metadata := map[string]string{"host": "host1", "job": "42"}
+	value := encodeLockValue("token", metadata)
+	if token, md := decodeLockValue(value); token != "token" || md["host"] != "host1" || md["job"] != "42" {
+		t.Errorf("unexpected decoded value: %q, %v", token, md)
+	}
+	if value := encodeLockValue("token", nil); value != "token" {
+		t.Errorf("expect plain token without metadata, got: %q", value)
+	}
+	if token, md := decodeLockValue("{not json"); token != "{not json" || md != nil {
+		t.Errorf("expect invalid json as plain token, got: %q, %v", token, md)
+	}
+
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.EqualFold(args[0], "GET") {
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+		}
+		return "+OK\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	// 归属权只比较 token 部分
+	if owned, err := NewRedisLock("test_key", client, WithToken("token")).IsHeldByMe(ctx); err != nil || !owned {
+		t.Errorf("expect lock held by token, got: %v, %v", owned, err)
+	}
+	got, err := NewRedisLock("test_key", client, WithToken("other")).Inspect(ctx)
+	if err != nil || got["host"] != "host1" {
+		t.Errorf("Inspect failed: %v, %v", got, err)
+	}
+}
+
+func Test_redLockTryLockStatus(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		return "+OK\r\n"
+	})
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: addr},
+		{Network: "tcp", Address: addr},
+		{Network: "tcp", Address: "127.0.0.1:1"},
+	}
+	redLock, err := NewRedLock("test_key", confs, WithRedLockExpireDuration(5*time.Second), WithSingleNodesTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redLock.Close()
+
+	acquired, perNode := redLock.TryLockStatus(context.Background())
+	if acquired != 2 || len(perNode) != 3 {
+		t.Fatalf("expect 2 of 3 nodes acquired, got: %d, %v", acquired, perNode)
+	}
+	if perNode[0] != nil || perNode[1] != nil || perNode[2] == nil {
+		t.Errorf("expect only the unreachable node to fail, got: %v", perNode)
+	}
+}
+
+func Test_DefaultTokenUnique(t *testing.T) {
+	client := NewClient("tcp", "127.0.0.1:1", "")
+	defer client.Close()
+
+	const n = 1000
+	tokens := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i] = NewRedisLock("test_key", client).token
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, n)
+	for _, token := range tokens {
+		if seen[token] {
+			t.Fatalf("duplicate default token: %s", token)
+		}
+		seen[token] = true
+	}
+}
+
+// 手动触发的续约节拍
+type fakeTicker struct {
+	ch chan time.Time
+}
+
+func (t *fakeTicker) Chan() <-chan time.Time { return t.ch }
+func (t *fakeTicker) Stop()                  {}
+
+func Test_renewLoop(t *testing.T) {
+	tk := &fakeTicker{ch: make(chan time.Time)}
+	renewed := make(chan struct{})
+	var calls int32
+	errRenew := errors.New("renew failed")
+	errs := make(chan error, 10)
+	loop := renewLoop{
+		renewer: RenewerFunc(func(ctx context.Context) error {
+			defer func() { renewed <- struct{}{} }()
+			// 第二次续约失败
+			if atomic.AddInt32(&calls, 1) == 2 {
+				return errRenew
+			}
+			return nil
+		}),
+		interval:  time.Hour,
+		immediate: true,
+		newTicker: func(d time.Duration) ticker {
+			if d != time.Hour {
+				t.Errorf("expect ticker interval 1h, got: %v", d)
+			}
+			return tk
+		},
+		onErr: func(err error) { errs <- err },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		loop.run(ctx)
+		close(done)
+	}()
+
+	// 启动后立即续约一次，之后每个节拍续约一次
+	<-renewed
+	for i := 0; i < 2; i++ {
+		tk.ch <- time.Now()
+		<-renewed
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("expect 3 renewals, got: %d", n)
+	}
+	if len(errs) != 1 || <-errs != errRenew {
+		t.Error("expect the second renewal failure reported once")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("renew loop should exit after ctx cancelled")
+	}
+}
+
+func Test_WithRenewer(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		return "+OK\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	tk := &fakeTicker{ch: make(chan time.Time)}
+	renewed := make(chan struct{}, 1)
+	lock := NewRedisLock("test_key", client, WithRenewer(RenewerFunc(func(ctx context.Context) error {
+		renewed <- struct{}{}
+		return nil
+	})))
+	lock.newTicker = func(time.Duration) ticker { return tk }
+	if err := lock.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer lock.stopWatchDog()
+
+	tk.ch <- time.Now()
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Error("expect the custom renewer called on tick")
+	}
+}
+
+func Test_FakeClient(t *testing.T) {
+	client := NewFakeClient()
+	now := time.Now()
+	client.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_key", client, WithToken("token1"), WithExpireSeconds(5))
+	lock2 := NewRedisLock("test_key", client, WithToken("token2"), WithExpireSeconds(5))
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatalf("lock1.Lock failed: %v", err)
+	}
+	if err := lock2.Lock(ctx); !errors.Is(err, ErrLockAcquiredByOthers) {
+		t.Errorf("lock2.Lock should fail while lock1 holds the lock, got: %v", err)
+	}
+	if ttl, err := lock1.TTL(ctx); err != nil || ttl != 5*time.Second {
+		t.Errorf("expect ttl 5s, got: %v, %v", ttl, err)
+	}
+	if err := lock1.Extend(ctx, 10*time.Second); err != nil {
+		t.Errorf("lock1.Extend failed: %v", err)
+	}
+
+	// 推进时钟，锁过期后可被他人取得
+	now = now.Add(11 * time.Second)
+	if err := lock2.Lock(ctx); err != nil {
+		t.Fatalf("lock2.Lock should succeed after lock1 expired, got: %v", err)
+	}
+	if err := lock1.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("lock1.Unlock should fail after the lock expired, got: %v", err)
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Errorf("lock2.Unlock failed: %v", err)
+	}
+
+	// 可重入锁
+	reentrant := NewRedisLock("test_reentrant_key", client, WithToken("token"), WithReentrant(), WithExpireSeconds(5))
+	for i := 0; i < 2; i++ {
+		if err := reentrant.Lock(ctx); err != nil {
+			t.Fatalf("reentrant.Lock failed: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := reentrant.Unlock(ctx); err != nil {
+			t.Fatalf("reentrant.Unlock failed: %v", err)
+		}
+	}
+	if owned, err := reentrant.IsHeldByMe(ctx); err != nil || owned {
+		t.Errorf("reentrant lock should be released, got: %v, %v", owned, err)
+	}
+}
+
+func Test_redLockDefaultExpire(t *testing.T) {
+	clients := []LockClient{NewFakeClient(), NewFakeClient(), NewFakeClient()}
+	redLock, err := NewRedLockWithClients("test_key", clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redLock.expireDuration != DefaultLockExpireSeconds*time.Second {
+		t.Errorf("expect default expire %v, got: %v", DefaultLockExpireSeconds*time.Second, redLock.expireDuration)
+	}
+	for i, lock := range redLock.locks {
+		if lock.watchDogMode || lock.expireDuration != redLock.expireDuration {
+			t.Errorf("node lock %d should use fixed expire %v, got: %v, watchDogMode: %v", i, redLock.expireDuration, lock.expireDuration, lock.watchDogMode)
+		}
+	}
+
+	ctx := context.Background()
+	if err = redLock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	for i, lock := range redLock.locks {
+		lock.mu.Lock()
+		running := lock.stopDog != nil
+		lock.mu.Unlock()
+		if running {
+			t.Errorf("node lock %d should not start a watchdog", i)
+		}
+	}
+	if err = redLock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	// 节点数与单节点超时较大时，默认过期时间随之放大以满足校验
+	redLock, err = NewRedLockWithClients("test_key", clients, WithSingleNodesTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redLock.expireDuration != 30*time.Second {
+		t.Errorf("expect expire 30s, got: %v", redLock.expireDuration)
+	}
+}
+
+func Test_redLockPerNodeTimeout(t *testing.T) {
+	newNode := func(delay time.Duration) string {
+		return startRedisMock(t, func(args []string) string {
+			// 模拟距离较远的节点
+			time.Sleep(delay)
+			return "+OK\r\n"
+		})
+	}
+	confs := []*SingleNodeConf{
+		{Network: "tcp", Address: newNode(0)},
+		{Network: "tcp", Address: newNode(0)},
+		{Network: "tcp", Address: newNode(200 * time.Millisecond), Timeout: time.Second},
+	}
+	redLock, err := NewRedLock("test_key", confs, WithRedLockExpireDuration(20*time.Second), WithSingleNodesTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redLock.Close()
+	if redLock.timeouts[0] != 100*time.Millisecond || redLock.timeouts[2] != time.Second {
+		t.Errorf("unexpected node timeouts: %v", redLock.timeouts)
+	}
+
+	acquired, perNode := redLock.TryLockStatus(context.Background())
+	if acquired != 3 {
+		t.Errorf("distant node should succeed within its own timeout, acquired: %d, errs: %v", acquired, perNode)
+	}
+
+	// 各节点超时时间之和需满足过期时间的预算
+	confs[2].Timeout = 2 * time.Second
+	if _, err = NewRedLock("test_key", confs, WithRedLockExpireDuration(20*time.Second), WithSingleNodesTimeout(100*time.Millisecond)); err == nil {
+		t.Error("expect error when node timeouts exceed the expire budget")
+	}
+}
+
+// 记录执行过的命令的 redis.Conn
+type recordConn struct {
+	redis.Conn
+	cmds []string
+}
+
+func (c *recordConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.cmds = append(c.cmds, cmd)
+	return "PONG", nil
+}
+
+func Test_TestOnBorrow(t *testing.T) {
+	newTest := func(opts ...ClientOption) func(conn redis.Conn, t time.Time) error {
+		c := Client{}
+		for _, opt := range opts {
+			opt(&c.ClientOptions)
+		}
+		return c.testOnBorrow()
+	}
+
+	// 默认每次借出连接都 PING
+	conn := &recordConn{}
+	if err := newTest()(conn, time.Now()); err != nil || len(conn.cmds) != 1 || conn.cmds[0] != "PING" {
+		t.Errorf("expect a PING on borrow by default, got: %v, err: %v", conn.cmds, err)
+	}
+
+	if test := newTest(WithTestOnBorrow(false)); test != nil {
+		t.Error("TestOnBorrow should be nil when disabled")
+	}
+
+	// 仅检查空闲时间超过检查周期的连接
+	test := newTest(WithHealthCheckPeriod(time.Minute))
+	conn = &recordConn{}
+	if err := test(conn, time.Now()); err != nil || len(conn.cmds) != 0 {
+		t.Errorf("recently used connection should not be checked, got: %v, err: %v", conn.cmds, err)
+	}
+	if err := test(conn, time.Now().Add(-2*time.Minute)); err != nil || len(conn.cmds) != 1 {
+		t.Errorf("idle connection should be checked, got: %v, err: %v", conn.cmds, err)
+	}
+}
+
+func Test_LockDetailed(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_key", client, WithExpireDuration(200*time.Millisecond))
+	result, err := lock1.LockDetailed(ctx)
+	if err != nil {
+		t.Fatalf("LockDetailed failed: %v", err)
+	}
+	if !result.Acquired || result.Blocked || result.Attempts != 1 {
+		t.Errorf("expect an immediate acquisition, got: %+v", result)
+	}
+
+	// lock1 过期前 lock2 阻塞等锁
+	lock2 := NewRedisLock("test_key", client, WithBlock(), WithBlockWaitingSeconds(2), WithExpireDuration(time.Second))
+	result, err = lock2.LockDetailed(ctx)
+	if err != nil {
+		t.Fatalf("LockDetailed failed: %v", err)
+	}
+	defer lock2.Unlock(ctx)
+	if !result.Acquired || !result.Blocked || result.Attempts < 2 || result.WaitDuration < 100*time.Millisecond {
+		t.Errorf("expect a blocking acquisition, got: %+v", result)
+	}
+
+	// 非阻塞模式取锁失败
+	lock3 := NewRedisLock("test_key", client)
+	result, err = lock3.LockDetailed(ctx)
+	if !errors.Is(err, ErrLockAcquiredByOthers) || result.Acquired || result.Blocked || result.Attempts != 1 {
+		t.Errorf("expect a failed attempt, got: %+v, err: %v", result, err)
+	}
+}
+
+func Test_ReplicationWait(t *testing.T) {
+	var acked, released int32
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "WAIT":
+			return fmt.Sprintf(":%d\r\n", atomic.LoadInt32(&acked))
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			atomic.AddInt32(&released, 1)
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	atomic.StoreInt32(&acked, 2)
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10), WithReplicationWait(2, 50*time.Millisecond))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	// 确认写入的从节点数不足，加锁失败并释放锁
+	atomic.StoreInt32(&acked, 1)
+	lock = NewRedisLock("test_key", client, WithExpireSeconds(10), WithReplicationWait(2, 50*time.Millisecond))
+	if err := lock.Lock(ctx); !errors.Is(err, ErrReplicationTimeout) {
+		t.Errorf("expect ErrReplicationTimeout, got: %v", err)
+	}
+	if atomic.LoadInt32(&released) != 1 {
+		t.Errorf("lock should be released after replication timeout, released: %d", released)
+	}
+
+	// 不支持 WAIT 的客户端
+	lock = NewRedisLock("test_key", NewFakeClient(), WithExpireSeconds(10), WithReplicationWait(1, 0))
+	if err := lock.Lock(ctx); err == nil {
+		t.Error("expect error for client without replication wait support")
+	}
+	if lock.replicaWaitTimeout != DefaultReplicationWaitTimeout {
+		t.Errorf("expect default WAIT timeout, got: %v", lock.replicaWaitTimeout)
+	}
+}
+
+// SET NX 成功而 WAIT 失败的 ReplicationClient
+type waitFailClient struct {
+	*FakeClient
+}
+
+func (c waitFailClient) SetNXPXWait(ctx context.Context, key, value string, expireMilliseconds int64, numReplicas int, timeout time.Duration) (int64, int64, error) {
+	reply, err := c.SetNXPX(ctx, key, value, expireMilliseconds)
+	if err != nil {
+		return -1, 0, err
+	}
+	return reply, 0, errors.New("ERR WAIT cannot be used with replica instances")
+}
+
+// WAIT 失败时加锁失败，已写入的锁被释放，其他竞争者可立即取锁
+func Test_ReplicationWaitError(t *testing.T) {
+	client := waitFailClient{NewFakeClient()}
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10), WithReplicationWait(1, 50*time.Millisecond))
+	if err := lock.Lock(ctx); err == nil {
+		t.Fatal("Lock should fail when WAIT fails")
+	}
+	if pttl, _ := client.PTTL(ctx, lock.getLockKey()); pttl != -2 {
+		t.Errorf("lock should be released after WAIT failure, got pttl: %d", pttl)
+	}
+
+	other := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	if err := other.Lock(ctx); err != nil {
+		t.Errorf("lock should be free after WAIT failure, got: %v", err)
+	}
+}
+
+type traceIDKey struct{}
+
+func Test_LogContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	extract := func(ctx context.Context) []any {
+		if id, ok := ctx.Value(traceIDKey{}).(string); ok {
+			return []any{"trace_id", id}
+		}
+		return nil
+	}
+	lock := NewRedisLock("test_key", NewFakeClient(), WithExpireSeconds(10),
+		WithLogger(newWriterLogger(&buf, LevelDebug, 0)), WithLogContextFields(extract))
+
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "abc")
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "tryLock: SETNX 结果 key=REDIS_LOCK_PREFIX_test_key reply=1 err=<nil> trace_id=abc") {
+		t.Errorf("log should carry the trace id, got: %q", buf.String())
+	}
+
+	// ctx 中没有 trace id 时不附加字段
+	buf.Reset()
+	if err := lock.DelayExpire(context.Background(), 10); err != nil {
+		t.Fatalf("DelayExpire failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "trace_id") {
+		t.Errorf("log should not carry a trace id, got: %q", buf.String())
+	}
+}
+
+func Test_GuardedSetGet(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10))
+
+	// 未持有锁时不能读写
+	if err := lock.GuardedSet(ctx, "test_data", "v1"); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld before Lock, got: %v", err)
+	}
+
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, err := lock.GuardedGet(ctx, "test_data"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expect ErrKeyNotFound, got: %v", err)
+	}
+	if err := lock.GuardedSet(ctx, "test_data", "v1"); err != nil {
+		t.Fatalf("GuardedSet failed: %v", err)
+	}
+	if value, err := lock.GuardedGet(ctx, "test_data"); err != nil || value != "v1" {
+		t.Errorf("expect v1, got: %q, err: %v", value, err)
+	}
+
+	// 其他持有者不能读写
+	other := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	if err := other.GuardedSet(ctx, "test_data", "v2"); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld for other token, got: %v", err)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if _, err := lock.GuardedGet(ctx, "test_data"); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld after Unlock, got: %v", err)
+	}
+	if value, _ := client.Get(ctx, "test_data"); value != "v1" {
+		t.Errorf("data should be kept after Unlock, got: %q", value)
+	}
+}
+
+func Test_PoolWaitTimeout(t *testing.T) {
+	addr := startRedisMock(t, func(args []string) string {
+		return "+OK\r\n"
+	})
+	client := NewClient("tcp", addr, "", WithMaxActive(1), WithWaitMode(), WithPoolWaitTimeout(50*time.Millisecond))
+	defer client.Close()
+	ctx := context.Background()
+
+	conn, err := client.getConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Wait 模式下连接池耗尽，等待连接超时
+	begin := time.Now()
+	if _, err = client.Get(ctx, "test_key"); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("expect ErrPoolExhausted, got: %v", err)
+	}
+	if cost := time.Since(begin); cost > time.Second {
+		t.Errorf("pool wait should be bounded, cost: %v", cost)
+	}
+
+	// 调用方 ctx 先于等待超时结束，返回 ctx 的错误
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = client.Get(cancelCtx, "test_key"); errors.Is(err, ErrPoolExhausted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expect context.Canceled, got: %v", err)
+	}
+}
+
+func Test_WatchDogLifecycleHooks(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+	started := make(chan struct{}, 1)
+	stopped := make(chan WatchDogStopReason, 1)
+	hooks := []LockOption{
+		WithOnWatchDogStart(func() { started <- struct{}{} }),
+		WithOnWatchDogStop(func(reason WatchDogStopReason) { stopped <- reason }),
+	}
+	expectStop := func(want WatchDogStopReason) {
+		t.Helper()
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("watchdog start hook not called")
+		}
+		select {
+		case reason := <-stopped:
+			if reason != want {
+				t.Errorf("expect stop reason %v, got: %v", want, reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("watchdog stop hook not called, expect: %v", want)
+		}
+	}
+
+	// 被 Unlock 停止
+	lock := NewRedisLock("test_key", client, hooks...)
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	expectStop(WatchDogStoppedByUnlock)
+
+	// watchDogCtx 结束
+	dogCtx, cancel := context.WithCancel(ctx)
+	lock = NewRedisLock("test_key", client, append(hooks, WithWatchDogContext(dogCtx))...)
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	cancel()
+	expectStop(WatchDogStoppedByContext)
+	lock.Unlock(ctx)
+
+	// 归属权检查发现锁已过期
+	now := time.Now()
+	var mu sync.Mutex
+	client.SetClock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	lock = NewRedisLock("test_key", client, append(hooks, WithExpireSeconds(1), WithOwnershipMonitor(10*time.Millisecond))...)
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	mu.Lock()
+	now = now.Add(2 * time.Second)
+	mu.Unlock()
+	expectStop(WatchDogStoppedByLockLost)
+}
+
+func Test_NonAtomicUnlock(t *testing.T) {
+	var deleted int32
+	// 模拟禁用了脚本的 redis
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			return "+OK\r\n"
+		case "GET":
+			return "$2\r\nt1\r\n"
+		case "DEL":
+			atomic.AddInt32(&deleted, 1)
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithToken("t1"), WithExpireSeconds(10))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := lock.Unlock(ctx); err == nil {
+		t.Error("lua unlock should fail without scripting")
+	}
+
+	lock = NewRedisLock("test_key", client, WithToken("t1"), WithExpireSeconds(10), WithNonAtomicUnlock())
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Errorf("non-atomic Unlock failed: %v", err)
+	}
+	if atomic.LoadInt32(&deleted) != 1 {
+		t.Errorf("expect the lock deleted once, got: %d", deleted)
+	}
+
+	// 锁已被他人持有，不会误删
+	lock = NewRedisLock("test_key", client, WithToken("t2"), WithExpireSeconds(10), WithNonAtomicUnlock())
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld, got: %v", err)
+	}
+	if atomic.LoadInt32(&deleted) != 1 {
+		t.Errorf("lock of others should not be deleted, got: %d", deleted)
+	}
+}
+
+// 同一实例循环加锁、解锁
+func Test_ReuseAfterUnlock(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithWatchDogInterval(time.Millisecond), WithImmediateRenewal())
+	token := lock.token
+	for i := 0; i < 100; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatalf("Lock %d failed: %v", i, err)
+		}
+		if lock.Errors() == nil {
+			t.Fatalf("watchdog should be restarted on Lock %d", i)
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock %d failed: %v", i, err)
+		}
+	}
+	if lock.token != token {
+		t.Error("token should be stable without WithTokenPerLock")
+	}
+
+	// 每次加锁生成新的 token
+	lock = NewRedisLock("test_key", client, WithTokenPerLock(), WithWatchDogInterval(time.Millisecond), WithImmediateRenewal())
+	tokens := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatalf("Lock %d failed: %v", i, err)
+		}
+		if held, err := lock.IsHeldByMe(ctx); err != nil || !held {
+			t.Fatalf("lock %d should be held, err: %v", i, err)
+		}
+		tokens[lock.token] = true
+		// 持有锁时再次加锁沿用当前 token(不可重入锁加锁失败)
+		if acquired, _ := lock.TryLock(ctx); acquired || !tokens[lock.token] {
+			t.Fatalf("token should not change while the lock is held")
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock %d failed: %v", i, err)
+		}
+	}
+	if len(tokens) != 100 {
+		t.Errorf("expect a fresh token per Lock, got %d distinct tokens", len(tokens))
+	}
+
+	// 显式指定的 token 不变
+	lock = NewRedisLock("test_key", client, WithTokenPerLock(), WithToken("fixed"), WithExpireSeconds(10))
+	for i := 0; i < 3; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatalf("Lock %d failed: %v", i, err)
+		}
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock %d failed: %v", i, err)
+		}
+	}
+	if lock.token != "fixed" {
+		t.Errorf("explicit token should be kept, got: %q", lock.token)
+	}
+}
+
+func Test_Contention(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+	holder := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			waiter := NewRedisLock("test_key", client, WithExpireSeconds(10), WithBlock(), WithContentionTracking())
+			waiter.Lock(waitCtx)
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		count, err := holder.Contention(ctx)
+		if err != nil {
+			t.Fatalf("Contention failed: %v", err)
+		}
+		if count == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect 3 waiters, got: %d", count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 等锁方放弃等锁后注销登记
+	cancel()
+	wg.Wait()
+	if count, err := holder.Contention(ctx); err != nil || count != 0 {
+		t.Errorf("expect no waiters, got: %d, err: %v", count, err)
+	}
+}
+
+// 锁丢失时会话 ctx 立即取消，Close 释放锁
+func Test_Session(t *testing.T) {
+	client := NewFakeClient()
+	lock := NewRedisLock("test_key", client, WithWatchDogInterval(10*time.Millisecond))
+	session, err := NewSession(context.Background(), lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.Context().Err(); err != nil {
+		t.Fatalf("session should be alive while holding the lock, got: %v", err)
+	}
+	// 模拟锁被删除，看门狗续约发现锁已不再持有
+	_ = client.Del(context.Background(), lock.getLockKey())
+	select {
+	case <-session.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect session ctx cancelled after the lock is lost")
+	}
+	_ = session.Close()
+
+	// 固定过期时间的锁，会话在锁过期时结束；Close 可重复调用
+	lock = NewRedisLock("fixed_key", client, WithExpireDuration(50*time.Millisecond))
+	if session, err = NewSession(context.Background(), lock); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := session.Context().Deadline(); !ok {
+		t.Error("expect session deadline for a fixed expire lock")
+	}
+	if err = session.Close(); err != nil {
+		t.Errorf("close session: %v", err)
+	}
+	if err = session.Close(); err != nil {
+		t.Errorf("close session twice: %v", err)
+	}
+	if session.Context().Err() == nil {
+		t.Error("expect session ctx cancelled after Close")
+	}
+	if _, err = client.Get(context.Background(), lock.getLockKey()); !errors.Is(err, ErrKeyNotFound) {
+		t.Error("expect lock released after Close")
+	}
+
+	// 红锁续约未取得多数席位时取消会话 ctx
+	clients := []LockClient{NewFakeClient(), NewFakeClient(), NewFakeClient()}
+	redLock, err := NewRedLockWithClients("red_key", clients, WithRedLockWatchDog(),
+		WithRedLockExpireDuration(300*time.Millisecond), WithSingleNodesTimeout(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session, err = NewRedLockSession(context.Background(), redLock); err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	for _, c := range clients[:2] {
+		_ = c.Del(context.Background(), RedisLockKeyPrefix+"red_key")
+	}
+	select {
+	case <-session.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect redlock session ctx cancelled after losing the majority")
+	}
+}
+
+// 剩余有效期需扣除时钟漂移，扣除后非正时加锁失败
+func Test_redLockDrift(t *testing.T) {
+	clients := []LockClient{NewFakeClient(), NewFakeClient(), NewFakeClient()}
+	redLock, err := NewRedLockWithClients("test_key", clients, WithRedLockExpireDuration(time.Second),
+		WithSingleNodesTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validity, err := redLock.LockWithValidity(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 默认漂移 = 1s * 0.01 + 2ms
+	if maxValidity := time.Second - 12*time.Millisecond; validity > maxValidity {
+		t.Errorf("expect validity <= %v after default drift, got: %v", maxValidity, validity)
+	}
+	_ = redLock.Unlock(context.Background())
+
+	redLock, err = NewRedLockWithClients("test_key", clients, WithRedLockExpireDuration(time.Second),
+		WithSingleNodesTimeout(10*time.Millisecond), WithDriftFactor(0.5), WithDriftConstant(500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = redLock.Lock(context.Background()); err == nil {
+		t.Error("expect lock failed when drift consumes the whole validity")
+	}
+	// 加锁失败后各节点上的锁均已释放
+	for i, c := range clients {
+		if _, err = c.Get(context.Background(), RedisLockKeyPrefix+"test_key"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("expect node %d released, got: %v", i, err)
+		}
+	}
+}
+
+// 续约参数以十进制整数传入脚本，大时长正常续约，非正时长不会删除锁
+func Test_RenewNumericArgs(t *testing.T) {
+	args := lockScriptArgs("key", "token", 0, 315360000000)
+	if args[2] != "0" || args[3] != "315360000000" {
+		t.Errorf("expect decimal integer args, got: %v", args)
+	}
+
+	client := NewFakeClient()
+	now := time.Now()
+	client.SetClock(func() time.Time { return now })
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	ctx := context.Background()
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 10 年
+	if err := lock.DelayExpire(ctx, 315360000); err != nil {
+		t.Errorf("renew with large duration: %v", err)
+	}
+	if ttl, _ := client.PTTL(ctx, lock.getLockKey()); ttl != 315360000000 {
+		t.Errorf("expect ttl 315360000000ms, got: %d", ttl)
+	}
+	if err := lock.Extend(ctx, 24*time.Hour*365); err != nil {
+		t.Errorf("extend with large duration: %v", err)
+	}
+
+	if err := lock.DelayExpire(ctx, 0); !errors.Is(err, ErrRenewFailed) || !errors.Is(err, ErrInvalidExpire) {
+		t.Errorf("expect ErrRenewFailed wrapping ErrInvalidExpire, got: %v", err)
+	}
+	if err := lock.Extend(ctx, 0); !errors.Is(err, ErrInvalidExpire) {
+		t.Errorf("expect ErrInvalidExpire, got: %v", err)
+	}
+	// 脚本本身同样拒绝非正时长
+	reply, err := client.Eval(ctx, LuaCheckAndExpireDistributionLock, 1, lockScriptArgs(lock.getLockKey(), lock.token, 0))
+	if err != nil || reply.(int64) != 0 {
+		t.Errorf("expect script reject zero duration, got: %v, %v", reply, err)
+	}
+	if _, err = client.Get(ctx, lock.getLockKey()); err != nil {
+		t.Errorf("lock should survive a zero duration renewal: %v", err)
+	}
+}
+
+// 配置校验返回所有问题，合法配置返回 nil
+func Test_ValidateOptions(t *testing.T) {
+	if err := ValidateLockOptions(WithBlock(), WithExpireSeconds(10)); err != nil {
+		t.Errorf("expect valid config, got: %v", err)
+	}
+	err := ValidateLockOptions(WithWatchDogInterval(20*time.Second), WithBlockWaitingSeconds(3), WithNonAtomicUnlock())
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) || len(cfgErr.Issues) != 3 {
+		t.Fatalf("expect 3 issues, got: %v", err)
+	}
+	if err = ValidateLockOptions(WithExpireSeconds(0)); !errors.Is(err, ErrInvalidExpire) {
+		t.Errorf("expect ErrInvalidExpire, got: %v", err)
+	}
+
+	confs := []*SingleNodeConf{{Address: "a"}, {Address: "b"}, {Address: "c"}}
+	if err = ValidateRedLockOptions(confs, WithRedLockExpireDuration(10*time.Second)); err != nil {
+		t.Errorf("expect valid redlock config, got: %v", err)
+	}
+	err = ValidateRedLockOptions(confs, WithRedLockExpireDuration(time.Second),
+		WithSingleNodesTimeout(100*time.Millisecond), WithDriftFactor(0.9), WithQuorum(1))
+	if !errors.As(err, &cfgErr) || len(cfgErr.Issues) != 3 {
+		t.Errorf("expect 3 redlock issues, got: %v", err)
+	}
+	if err = ValidateRedLockOptions(nil); err == nil {
+		t.Error("expect error without nodes")
+	}
+}
+
+// IsWatchDogMode 反映 repairLock 的最终决定
+func Test_IsWatchDogMode(t *testing.T) {
+	client := NewFakeClient()
+	cases := []struct {
+		opts   []LockOption
+		expect bool
+	}{
+		{nil, true},
+		{[]LockOption{WithExpireSeconds(10)}, false},
+		{[]LockOption{WithExpireDuration(200 * time.Millisecond)}, false},
+		{[]LockOption{WithExpireAt(time.Now().Add(time.Minute))}, false},
+		{[]LockOption{WithNoWatchDog()}, false},
+		{[]LockOption{WithWatchDogInterval(time.Second)}, true},
+	}
+	for i, c := range cases {
+		if got := NewRedisLock("test_key", client, c.opts...).IsWatchDogMode(); got != c.expect {
+			t.Errorf("case %d: expect watchdog mode %v, got: %v", i, c.expect, got)
+		}
+	}
+}
+
+// Unlock 等待锁被持有满最短持有时间，ctx 结束时放弃等待且不释放锁
+func Test_MinHoldTime(t *testing.T) {
+	client := NewFakeClient()
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10), WithMinHoldTime(100*time.Millisecond))
+	ctx := context.Background()
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if held := time.Since(begin); held < 90*time.Millisecond {
+		t.Errorf("expect unlock to wait for the min hold time, waited: %v", held)
+	}
+
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := lock.Unlock(cancelCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect unlock aborted by ctx, got: %v", err)
+	}
+	if _, err := client.Get(ctx, lock.getLockKey()); err != nil {
+		t.Errorf("lock should still be held after aborted unlock: %v", err)
+	}
+	// 已持有满最短持有时间，立即释放
+	time.Sleep(100 * time.Millisecond)
+	begin = time.Now()
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(begin); waited > 50*time.Millisecond {
+		t.Errorf("expect no wait after the min hold time, waited: %v", waited)
+	}
+}
+
+// 记录解锁通知发布到的 channel
+type publishRecorder struct {
+	*FakeClient
+	channels []string
+}
+
+func (p *publishRecorder) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	if src == LuaPublishUnlockNotify {
+		p.channels = append(p.channels, fmt.Sprint(keyAndArgs[0]))
+	}
+	return p.FakeClient.Eval(ctx, src, keyCount, keyAndArgs)
+}
+
+// WithNotifyChannel 自定义解锁通知的 channel，生成空 channel 时加锁失败
+func Test_NotifyChannel(t *testing.T) {
+	client := &publishRecorder{FakeClient: NewFakeClient()}
+	ctx := context.Background()
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10), WithNotifyWait())
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = lock.Unlock(ctx)
+
+	lock = NewRedisLock("test_key", client, WithExpireSeconds(10), WithNotifyWait(),
+		WithNotifyChannel(func(key string) string { return "svc-orders:unlock:" + key }))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = lock.Unlock(ctx)
+
+	expect := []string{RedisLockNotifyPrefix + "test_key", "svc-orders:unlock:test_key"}
+	if fmt.Sprint(client.channels) != fmt.Sprint(expect) {
+		t.Errorf("expect channels %v, got: %v", expect, client.channels)
+	}
+
+	lock = NewRedisLock("test_key", client, WithNotifyWait(), WithNotifyChannel(func(string) string { return "" }))
+	if err := lock.Lock(ctx); !errors.Is(err, ErrEmptyNotifyChannel) {
+		t.Errorf("expect ErrEmptyNotifyChannel, got: %v", err)
+	}
+}
+
+// 红锁看门狗：超过过期时间后仍持有锁、Unlock 后立即停止、解锁后可立即再次加锁、续约失败时通过 Errors() 上报
+func Test_redLockWatchDog(t *testing.T) {
+	clients := []LockClient{NewFakeClient(), NewFakeClient(), NewFakeClient()}
+	redLock, err := NewRedLockWithClients("test_key", clients, WithRedLockWatchDog(),
+		WithRedLockExpireDuration(300*time.Millisecond), WithSingleNodesTimeout(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	lockKey := RedisLockKeyPrefix + "test_key"
+	held := func() int {
+		n := 0
+		for _, c := range clients {
+			if _, err := c.Get(ctx, lockKey); err == nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	if err = redLock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 续约超过两倍的过期时间
+	time.Sleep(700 * time.Millisecond)
+	if n := held(); n != 3 {
+		t.Errorf("expect lock renewed on all nodes past expire, held on %d", n)
+	}
+
+	if err = redLock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	redLock.mu.Lock()
+	done := redLock.dogDone
+	redLock.mu.Unlock()
+	select {
+	case <-done:
+	case <-time.After(50 * time.Millisecond):
+		t.Error("expect watchdog stopped right after Unlock")
+	}
+
+	// 解锁后立即再次加锁，不应等待上一次的看门狗
+	begin := time.Now()
+	if err = redLock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(begin); cost > 50*time.Millisecond {
+		t.Errorf("expect relock without delay, cost: %v", cost)
+	}
+
+	// 多数节点上的锁丢失，续约失败通过 Errors() 上报并关闭通道
+	errCh := redLock.Errors()
+	for _, c := range clients[:2] {
+		_ = c.Del(ctx, lockKey)
+	}
+	select {
+	case err, ok := <-errCh:
+		if !ok || err == nil {
+			t.Errorf("expect renewal error, got: %v, %v", err, ok)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect renewal error reported through Errors()")
+	}
+	if _, ok := <-errCh; ok {
+		t.Error("expect Errors() closed after the watchdog exits")
+	}
+}
+
+// 脚本总是执行成功的客户端，用于测试不依赖脚本结果的流程(FakeClient 不支持信号量脚本)
+type alwaysOKClient struct {
+	*FakeClient
+}
+
+func (c alwaysOKClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	return int64(1), nil
+}
+
+// 已持有信号量时再次 Acquire 立即返回且只有一个看门狗，Release 后看门狗退出
+func Test_SemaphoreReacquire(t *testing.T) {
+	sem := NewSemaphore("test_sem", 2, alwaysOKClient{NewFakeClient()}, WithWatchDogInterval(10*time.Millisecond))
+	ctx := context.Background()
+	if err := sem.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sem.mu.Lock()
+	firstDone := sem.dogDone
+	sem.mu.Unlock()
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- sem.Acquire(ctx) }()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second Acquire by the same holder should not block")
+	}
+	sem.mu.Lock()
+	if sem.dogDone != firstDone {
+		t.Error("expect the running watchdog to be reused")
+	}
+	sem.mu.Unlock()
+
+	if err := sem.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-firstDone:
+	case <-time.After(100 * time.Millisecond):
+		t.Error("expect watchdog stopped after Release")
+	}
+	// 释放后可再次获取并重新启动看门狗
+	if err := sem.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sem.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 等锁队列、等锁计数的 key 以 WithKeyPrefix 为命名空间，不同前缀的同名锁互不干扰
+func Test_DerivedKeysWithPrefix(t *testing.T) {
+	client := NewFakeClient()
+	def := NewRedisLock("test_key", client)
+	if !strings.HasPrefix(def.getQueueKey(), RedisLockQueuePrefix+"test_key") || def.getWaitersKey() != RedisLockWaitersPrefix+"test_key" {
+		t.Errorf("unexpected default keys: %s, %s", def.getQueueKey(), def.getWaitersKey())
+	}
+
+	orders := NewRedisLock("test_key", client, WithKeyPrefix("svc-orders:"), WithContentionTracking())
+	stock := NewRedisLock("test_key", client, WithKeyPrefix("svc-stock:"), WithContentionTracking())
+	if !strings.HasPrefix(orders.getQueueKey(), "svc-orders:"+RedisLockQueuePrefix+"test_key") {
+		t.Errorf("unexpected queue key: %s", orders.getQueueKey())
+	}
+	if orders.getWaitersKey() != "svc-orders:"+RedisLockWaitersPrefix+"test_key" {
+		t.Errorf("unexpected waiters key: %s", orders.getWaitersKey())
+	}
+	if orders.getWaitersKey() == stock.getWaitersKey() || orders.getQueueKey() == stock.getQueueKey() {
+		t.Error("expect derived keys of different prefixes not to collide")
+	}
+
+	ctx := context.Background()
+	leave := orders.enterWaiters(ctx)
+	defer leave()
+	if n, err := orders.Contention(ctx); err != nil || n != 1 {
+		t.Errorf("expect 1 waiter under svc-orders, got: %d, %v", n, err)
+	}
+	if n, err := stock.Contention(ctx); err != nil || n != 0 {
+		t.Errorf("expect no waiter under svc-stock, got: %d, %v", n, err)
+	}
+}
+
+// 记录所有脚本调用的参数
+type evalArgsRecorder struct {
+	alwaysOKClient
+	mu   sync.Mutex
+	args [][]interface{}
+}
+
+func (c *evalArgsRecorder) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	c.mu.Lock()
+	c.args = append(c.args, keyAndArgs)
+	c.mu.Unlock()
+	return c.alwaysOKClient.Eval(ctx, src, keyCount, keyAndArgs)
+}
+
+// 所有内置脚本的参数(包括数值参数)均以字符串传入
+func Test_ScriptArgsAreStrings(t *testing.T) {
+	client := &evalArgsRecorder{alwaysOKClient: alwaysOKClient{NewFakeClient()}}
+	ctx := context.Background()
+
+	_ = NewSemaphore("sem", 3, client, WithExpireSeconds(10)).Acquire(ctx)
+	_ = NewRedisLock("owner", client, WithExpireSeconds(10), WithOwnerDiagnostics()).Lock(ctx)
+	_ = NewRedisLock("fair", client, WithExpireSeconds(10), WithBlock(), WithFairQueue()).Lock(ctx)
+	_ = NewRedisLock("script", client, WithExpireSeconds(10), WithAcquireScript("return 1")).Lock(ctx)
+	_ = NewMultiLock([]string{"a", "b"}, client, WithExpireSeconds(10)).LockAtomic(ctx)
+	rw := NewRWRedisLock("rw", client, WithExpireSeconds(10))
+	_ = rw.RLock(ctx)
+	_ = rw.Lock(ctx)
+	lock := NewRedisLock("waiters", client, WithContentionTracking())
+	lock.enterWaiters(ctx)()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.args) < 8 {
+		t.Fatalf("expect scripts called, got %d calls", len(client.args))
+	}
+	for _, args := range client.args {
+		for _, arg := range args {
+			if _, ok := arg.(string); !ok {
+				t.Errorf("expect string script args, got %T in %v", arg, args)
+			}
+		}
+	}
+}
+
+// EVALSHA 返回 NOSCRIPT(脚本缓存被清空)时回退至 EVAL，EVAL 重新缓存脚本后继续使用 EVALSHA
+func Test_EvalNoScriptFallback(t *testing.T) {
+	var mu sync.Mutex
+	cached := false
+	cmds := map[string]int{}
+	addr := startRedisMock(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		cmd := strings.ToUpper(args[0])
+		cmds[cmd]++
+		switch cmd {
+		case "SCRIPT":
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			if !cached {
+				return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+			}
+			return ":1\r\n"
+		case "EVAL":
+			cached = true
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		reply, err := client.Eval(ctx, "return 1", 0, nil)
+		if err != nil || reply.(int64) != 1 {
+			t.Fatalf("eval %d: %v, %v", i, reply, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cmds["EVAL"] != 1 {
+		t.Errorf("expect a single EVAL fallback, got: %d", cmds["EVAL"])
+	}
+	if cmds["EVALSHA"] != 2 {
+		t.Errorf("expect EVALSHA used again after re-caching, got: %d", cmds["EVALSHA"])
+	}
+	if cmds["SCRIPT"] != 1 {
+		t.Errorf("expect the sha loaded once, got: %d SCRIPT LOAD", cmds["SCRIPT"])
+	}
+}
+
+// 可重入锁：同一 token 重复加锁累加重入次数，解锁递减，归零时才删除锁；其他 token 无法解锁
+func Test_ReentrantLock(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithReentrant(), WithToken("owner"), WithExpireSeconds(10))
+	for i := 0; i < 2; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatalf("Lock %d failed: %v", i, err)
+		}
+	}
+	count := func() int64 {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if entry := client.getLocked(lock.getLockKey()); entry != nil {
+			return entry.hash["owner"]
+		}
+		return 0
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("expect reentrant count 2, got: %d", n)
+	}
+
+	// 其他 token 既不能加锁也不能解锁
+	other := NewRedisLock("test_key", client, WithReentrant(), WithToken("other"), WithExpireSeconds(10))
+	if acquired, err := other.TryLock(ctx); err != nil || acquired {
+		t.Errorf("lock held by others should not be acquired, got: %v, %v", acquired, err)
+	}
+	if err := other.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld, got: %v", err)
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("unlock by others should not change the count, got: %d", n)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if held, err := lock.IsHeldByMe(ctx); err != nil || !held || count() != 1 {
+		t.Fatalf("lock should still be held once, got count: %d, err: %v", count(), err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if pttl, _ := client.PTTL(ctx, lock.getLockKey()); pttl != -2 {
+		t.Errorf("lock key should be deleted, got pttl: %d", pttl)
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld after release, got: %v", err)
+	}
+}
+
+// TryLock 只尝试一次：锁被他人持有时立即返回 (false, nil)，锁空闲时返回 (true, nil)
+func Test_TryLock(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	if acquired, err := lock1.TryLock(ctx); err != nil || !acquired {
+		t.Fatalf("TryLock on a free lock should succeed, got: %v, %v", acquired, err)
+	}
+
+	// 即使开启了阻塞模式，TryLock 也不等锁
+	lock2 := NewRedisLock("test_key", client, WithExpireSeconds(10), WithBlock(), WithBlockWaitingSeconds(5))
+	begin := time.Now()
+	acquired, err := lock2.TryLock(ctx)
+	if err != nil || acquired {
+		t.Fatalf("TryLock on a held lock should fail, got: %v, %v", acquired, err)
+	}
+	if cost := time.Since(begin); cost > 100*time.Millisecond {
+		t.Errorf("TryLock should return immediately, cost: %v", cost)
+	}
+
+	if err = lock1.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if acquired, err = lock2.TryLock(ctx); err != nil || !acquired {
+		t.Fatalf("TryLock after release should succeed, got: %v, %v", acquired, err)
+	}
+	if err = lock2.Unlock(ctx); err != nil {
+		t.Errorf("Unlock failed: %v", err)
+	}
+}
+
+// TTL：持有锁时返回剩余时间；锁不存在(PTTL -2)返回 ErrLockNotHeld；未设置过期时间(PTTL -1)返回 -1；他人持有时返回 ErrLockAcquiredByOthers
+func Test_TTL(t *testing.T) {
+	client := NewFakeClient()
+	now := time.Now()
+	client.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithToken("owner"), WithExpireSeconds(10))
+	if ttl, err := lock.TTL(ctx); !errors.Is(err, ErrLockNotHeld) || ttl != 0 {
+		t.Errorf("expect (0, ErrLockNotHeld) for a missing lock, got: %v, %v", ttl, err)
+	}
+
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	now = now.Add(3 * time.Second)
+	if ttl, err := lock.TTL(ctx); err != nil || ttl != 7*time.Second {
+		t.Errorf("expect 7s left, got: %v, %v", ttl, err)
+	}
+
+	other := NewRedisLock("test_key", client, WithToken("other"), WithExpireSeconds(10))
+	if ttl, err := other.TTL(ctx); !errors.Is(err, ErrLockAcquiredByOthers) || ttl != 7*time.Second {
+		t.Errorf("expect 7s left and ErrLockAcquiredByOthers, got: %v, %v", ttl, err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	// 未设置过期时间的锁
+	if _, err := client.SetNX(ctx, lock.getLockKey(), "owner", 0); err != nil {
+		t.Fatalf("SetNX failed: %v", err)
+	}
+	if ttl, err := lock.TTL(ctx); err != nil || ttl != -1 {
+		t.Errorf("expect -1 for a lock without expire, got: %v, %v", ttl, err)
+	}
+}
+
+// Extend 将剩余时间设置为 d；token 不匹配或锁已过期时返回 ErrLockNotHeld
+func Test_Extend(t *testing.T) {
+	client := NewFakeClient()
+	now := time.Now()
+	client.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithToken("owner"), WithExpireSeconds(2))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := lock.Extend(ctx, 5*time.Second); err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	if pttl, _ := client.PTTL(ctx, lock.getLockKey()); pttl != 5000 {
+		t.Errorf("expect pttl 5000 after Extend, got: %d", pttl)
+	}
+
+	other := NewRedisLock("test_key", client, WithToken("other"), WithExpireSeconds(2))
+	if err := other.Extend(ctx, 10*time.Second); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld for a foreign token, got: %v", err)
+	}
+	if pttl, _ := client.PTTL(ctx, lock.getLockKey()); pttl != 5000 {
+		t.Errorf("foreign Extend should not change pttl, got: %d", pttl)
+	}
+
+	// 锁过期后不能再延长
+	now = now.Add(5 * time.Second)
+	if err := lock.Extend(ctx, 5*time.Second); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld for an expired lock, got: %v", err)
+	}
+	if pttl, _ := client.PTTL(ctx, lock.getLockKey()); pttl != -2 {
+		t.Errorf("expired lock should not be recreated, got pttl: %d", pttl)
+	}
+}
+
+// 以 Go 通道模拟 pub/sub 的 FakeClient，执行解锁通知脚本时通知该 channel 的订阅方
+type pubSubClient struct {
+	*FakeClient
+	mu   sync.Mutex
+	subs map[string][]chan struct{}
+}
+
+func (p *pubSubClient) Subscribe(ctx context.Context, channel string) (<-chan struct{}, func(), error) {
+	ch := make(chan struct{}, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subs[channel] = append(p.subs[channel], ch)
+	cancel := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		subs := p.subs[channel]
+		for i, sub := range subs {
+			if sub == ch {
+				p.subs[channel] = append(subs[:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+	return ch, cancel, nil
+}
+
+func (p *pubSubClient) subscribers(channel string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subs[channel])
+}
+
+func (p *pubSubClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	if src != LuaPublishUnlockNotify {
+		return p.FakeClient.Eval(ctx, src, keyCount, keyAndArgs)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subs := p.subs[fmt.Sprint(keyAndArgs[0])]
+	for _, ch := range subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return int64(len(subs)), nil
+}
+
+// WithNotifyWait 模式下解锁通知唤醒阻塞的等锁方，无需等到下一次轮询
+func Test_NotifyWaitWakeUp(t *testing.T) {
+	client := &pubSubClient{FakeClient: NewFakeClient(), subs: make(map[string][]chan struct{})}
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_key", client, WithExpireSeconds(10), WithNotifyWait())
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	lock2 := NewRedisLock("test_key", client, WithExpireSeconds(10), WithNotifyWait(),
+		WithBlock(), WithBlockWaitingSeconds(5), WithPollInterval(2*time.Second))
+	done := make(chan error, 1)
+	go func() {
+		done <- lock2.Lock(ctx)
+	}()
+
+	// 等待 lock2 订阅解锁通知后再解锁
+	channel := lock2.getNotifyChannel()
+	for i := 0; client.subscribers(channel) == 0; i++ {
+		if i > 100 {
+			t.Fatal("waiter did not subscribe to unlock notify")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	begin := time.Now()
+	if err := lock1.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("waiter Lock failed: %v", err)
+		}
+		if cost := time.Since(begin); cost > 500*time.Millisecond {
+			t.Errorf("waiter should be woken up by unlock notify, cost: %v", cost)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not woken up before the poll interval")
+	}
+	if err := lock2.Unlock(ctx); err != nil {
+		t.Errorf("Unlock failed: %v", err)
+	}
+	if n := client.subscribers(channel); n != 0 {
+		t.Errorf("waiter should unsubscribe after acquisition, got %d subscribers", n)
+	}
+}
+
+// WithAcquireTimeout 限制阻塞取锁的总耗时，超时返回包装了 context.DeadlineExceeded 的错误
+func Test_AcquireTimeout(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock1 := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	if err := lock1.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	defer lock1.Unlock(ctx)
+
+	lock2 := NewRedisLock("test_key", client, WithExpireSeconds(10), WithBlock(), WithBlockWaitingSeconds(5),
+		WithPollInterval(20*time.Millisecond), WithAcquireTimeout(100*time.Millisecond))
+	begin := time.Now()
+	err := lock2.Lock(ctx)
+	cost := time.Since(begin)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got: %v", err)
+	}
+	if cost < 100*time.Millisecond || cost > 300*time.Millisecond {
+		t.Errorf("expect Lock to give up after about 100ms, cost: %v", cost)
+	}
+	if held, _ := lock2.IsHeldByMe(ctx); held {
+		t.Error("lock should not be held after acquire timeout")
+	}
+}
+
+// 逻辑库编号为负数时构造失败或执行命令时返回 ErrInvalidDatabase，不会静默回退到 0 号库
+// 编号上限由服务端校验：SELECT 超出 databases 配置的编号时拨号失败
+func Test_ClientDatabaseRange(t *testing.T) {
+	var mu sync.Mutex
+	var selected []string
+	addr := startRedisMock(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "SELECT" {
+			mu.Lock()
+			selected = append(selected, args[1])
+			mu.Unlock()
+			if args[1] == "16" {
+				return "-ERR DB index is out of range\r\n"
+			}
+			return "+OK\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		db      int
+		wantErr bool
+	}{
+		{db: -1, wantErr: true},
+		{db: 16, wantErr: true},
+		{db: 3},
+		{db: 64},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		selected = nil
+		mu.Unlock()
+		client := NewClient("tcp", addr, "", WithDatabase(tt.db))
+		err := client.Ping(ctx)
+		client.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("db %d: expect error %v, got: %v", tt.db, tt.wantErr, err)
+		}
+
+		mu.Lock()
+		got := selected
+		mu.Unlock()
+		if tt.db < 0 {
+			if !errors.Is(err, ErrInvalidDatabase) || len(got) != 0 {
+				t.Errorf("db %d: expect ErrInvalidDatabase without SELECT, got: %v, SELECT %v", tt.db, err, got)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0] != strconv.Itoa(tt.db) {
+			t.Errorf("db %d: expect SELECT %d, got: %v", tt.db, tt.db, got)
+		}
+	}
+
+	// 返回 error 的构造函数直接返回校验错误
+	if _, err := NewClientFromURL("redis://" + addr + "/-1"); !errors.Is(err, ErrInvalidDatabase) {
+		t.Errorf("expect ErrInvalidDatabase from NewClientFromURL, got: %v", err)
+	}
+	if _, err := NewSentinelClient("mymaster", []string{addr}, WithDatabase(-1)); !errors.Is(err, ErrInvalidDatabase) {
+		t.Errorf("expect ErrInvalidDatabase from NewSentinelClient, got: %v", err)
+	}
+}
+
+// WithTokenPerLock 的看门狗模式下锁丢失(续约失败)后再次加锁，不应等待仍在运行的看门狗而永久阻塞
+func Test_ReuseAfterLockLost(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithTokenPerLock(), WithWatchDogInterval(20*time.Millisecond))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	// 至少续约成功一次后删除锁，之后的续约均失败，过期时间不再推进
+	time.Sleep(50 * time.Millisecond)
+	_ = client.Del(ctx, lock.getLockKey())
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lock.Lock(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Lock after lock lost failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lock after lock lost blocked on the previous watchdog")
+	}
+	if held, err := lock.IsHeldByMe(ctx); err != nil || !held {
+		t.Errorf("lock should be held again, err: %v", err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Errorf("Unlock failed: %v", err)
+	}
+}
+
+// 一个脚本的 SCRIPT LOAD 阻塞时，不影响同一 Client 上其他脚本的执行；EVALSHA 使用本地计算的 SHA1
+func Test_EvalSlowScriptLoad(t *testing.T) {
+	release := make(chan struct{})
+	loading := make(chan struct{})
+	var once sync.Once
+	sum := sha1.Sum([]byte("return 2"))
+	fastSha := hex.EncodeToString(sum[:])
+	addr := startRedisMock(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "SCRIPT":
+			if args[2] == "return 1" {
+				once.Do(func() { close(loading) })
+				<-release
+			}
+			return "$3\r\nsha\r\n"
+		case "EVALSHA":
+			if args[1] == fastSha {
+				return ":2\r\n"
+			}
+			return ":1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	client := NewClient("tcp", addr, "")
+	defer client.Close()
+	defer close(release)
+
+	go func() {
+		_, _ = client.Eval(context.Background(), "return 1", 0, nil)
+	}()
+	<-loading
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	reply, err := client.Eval(ctx, "return 2", 0, nil)
+	if err != nil {
+		t.Fatalf("eval should not wait for another script's SCRIPT LOAD, err: %v", err)
+	}
+	if reply.(int64) != 2 {
+		t.Errorf("expect EVALSHA with the local sha1, got reply: %v", reply)
+	}
+}
+
+// 执行指定脚本时返回 err 的客户端，其他命令交由内嵌的 LockClient 执行
+type scriptErrClient struct {
+	LockClient
+	src string
+	err error
+}
+
+func (c *scriptErrClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	if src == c.src && c.err != nil {
+		return -1, c.err
+	}
+	return c.LockClient.Eval(ctx, src, keyCount, keyAndArgs)
+}
+
+// 看门狗是否在运行
+func watchDogRunning(r *RedisLock) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopDog != nil
+}
+
+// 可重入锁解锁请求失败时，服务端的重入次数可能未减少，看门狗应继续续约
+func Test_ReentrantUnlockError(t *testing.T) {
+	client := &scriptErrClient{LockClient: NewFakeClient(), src: LuaReentrantUnlock}
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithReentrant(), WithWatchDogInterval(10*time.Millisecond))
+	for i := 0; i < 2; i++ {
+		if err := lock.Lock(ctx); err != nil {
+			t.Fatalf("Lock %d failed: %v", i, err)
+		}
+	}
+
+	client.err = errors.New("connection reset by peer")
+	if err := lock.Unlock(ctx); err == nil {
+		t.Fatal("Unlock should fail")
+	}
+	if !watchDogRunning(lock) {
+		t.Fatal("watchdog should keep renewing after a failed unlock request")
+	}
+
+	client.err = nil
+	for i := 0; i < 2; i++ {
+		if err := lock.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock %d failed: %v", i, err)
+		}
+	}
+	if watchDogRunning(lock) {
+		t.Error("watchdog should stop after the lock is released")
+	}
+}
+
+// 释放读锁的请求失败时，读锁的看门狗应继续续约
+func Test_RUnlockError(t *testing.T) {
+	client := &scriptErrClient{LockClient: alwaysOKClient{NewFakeClient()}, src: LuaRWReadUnlock}
+	ctx := context.Background()
+
+	rw := NewRWRedisLock("rw", client, WithWatchDogInterval(10*time.Millisecond))
+	if err := rw.RLock(ctx); err != nil {
+		t.Fatalf("RLock failed: %v", err)
+	}
+	defer rw.readLock.stopWatchDog()
+
+	client.err = errors.New("connection reset by peer")
+	if err := rw.RUnlock(ctx); err == nil {
+		t.Fatal("RUnlock should fail")
+	}
+	if !watchDogRunning(rw.readLock) {
+		t.Error("read lock watchdog should keep renewing after a failed unlock request")
+	}
+}
+
+// 可重入锁以 hash 存储，Inspect 不应因 GET 返回 WRONGTYPE 而失败
+func Test_InspectReentrant(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithReentrant(), WithExpireSeconds(10))
+	if _, err := lock.Inspect(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expect ErrLockNotHeld for a missing lock, got: %v", err)
+	}
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	defer lock.Unlock(ctx)
+
+	other := NewRedisLock("test_key", client, WithReentrant(), WithToken("other"))
+	if metadata, err := other.Inspect(ctx); err != nil || metadata != nil {
+		t.Errorf("expect no metadata for a reentrant lock, got: %v, %v", metadata, err)
+	}
+}
+
+// 公平锁的等锁队列与锁位于同一槽位，cluster 模式下 LuaFairLock 不会出现 CROSSSLOT 错误
+func Test_FairQueueKeySlot(t *testing.T) {
+	client := NewFakeClient()
+	tests := []struct {
+		key  string
+		opts []LockOption
+	}{
+		{key: "test_key"},
+		{key: "order:42"},
+		{key: "{user}:1"},
+		{key: "test_key", opts: []LockOption{WithKeyPrefix("svc-orders:")}},
+		{key: "test_key", opts: []LockOption{WithKeyPrefix("{svc}:")}},
+	}
+	for _, tt := range tests {
+		lock := NewRedisLock(tt.key, client, append(tt.opts, WithFairQueue())...)
+		if ClusterSlot(lock.getQueueKey()) != ClusterSlot(lock.getLockKey()) {
+			t.Errorf("key %q: queue key %q is not in the slot of lock key %q", tt.key, lock.getQueueKey(), lock.getLockKey())
+		}
+	}
+	// 已与锁同槽位的队列 key 原样使用
+	if key := sameSlotKey("{user}:queue", "{user}:lock"); key != "{user}:queue" {
+		t.Errorf("expect key unchanged, got: %s", key)
+	}
+}
+
+// 开启 slow 后执行脚本前等待 delay 的 FakeClient，等待期间 ctx 结束时返回 ctx 的错误，模拟卡住的节点
+type slowFakeClient struct {
+	*FakeClient
+	delay time.Duration
+	slow  int32
+}
+
+func (c *slowFakeClient) Eval(ctx context.Context, src string, keyCount int, keyAndArgs []interface{}) (interface{}, error) {
+	if atomic.LoadInt32(&c.slow) == 1 {
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(c.delay):
+		}
+	}
+	return c.FakeClient.Eval(ctx, src, keyCount, keyAndArgs)
+}
+
+// 红锁解锁时单个慢节点受单节点超时约束，不拖慢整体解锁，其余节点的锁均被释放
+func Test_redLockUnlockSlowFakeNode(t *testing.T) {
+	slow := &slowFakeClient{FakeClient: NewFakeClient(), delay: 5 * time.Second}
+	fast1, fast2 := NewFakeClient(), NewFakeClient()
+	redLock, err := NewRedLockWithClients("test_key", []LockClient{slow, fast1, fast2},
+		WithRedLockExpireDuration(5*time.Second), WithSingleNodesTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = redLock.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	atomic.StoreInt32(&slow.slow, 1)
+	begin := time.Now()
+	if err = redLock.Unlock(ctx); err != nil {
+		t.Errorf("Unlock should succeed on the majority, got: %v", err)
+	}
+	if cost := time.Since(begin); cost > 200*time.Millisecond {
+		t.Errorf("Unlock should return within the per-node timeout, cost: %v", cost)
+	}
+	for i, client := range []*FakeClient{fast1, fast2} {
+		if pttl, _ := client.PTTL(ctx, redLock.locks[i+1].getLockKey()); pttl != -2 {
+			t.Errorf("lock on fast node %d should be released, got pttl: %d", i+1, pttl)
+		}
+	}
+}
+
+// 续约、延长租期的时长边界：0、负数、不足 1ms 被拒绝且不影响锁；超出 time.Duration 范围的秒数不会溢出
+func Test_RenewDurationBounds(t *testing.T) {
+	client := NewFakeClient()
+	now := time.Now()
+	client.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10))
+	if err := lock.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	maxSeconds := int64(math.MaxInt64 / time.Second)
+
+	delayTests := []struct {
+		seconds int64
+		wantErr bool
+		wantTTL int64
+	}{
+		{seconds: 0, wantErr: true, wantTTL: 10000},
+		{seconds: -1, wantErr: true, wantTTL: 10000},
+		{seconds: math.MaxInt64, wantErr: true, wantTTL: 10000},
+		{seconds: maxSeconds + 1, wantErr: true, wantTTL: 10000},
+		{seconds: maxSeconds, wantTTL: maxSeconds * 1000},
+	}
+	for _, tt := range delayTests {
+		err := lock.DelayExpire(ctx, tt.seconds)
+		if tt.wantErr != (err != nil) || (tt.wantErr && !errors.Is(err, ErrInvalidExpire)) {
+			t.Errorf("DelayExpire(%d): expect error %v, got: %v", tt.seconds, tt.wantErr, err)
+		}
+		if ttl, _ := client.PTTL(ctx, lock.getLockKey()); ttl != tt.wantTTL {
+			t.Errorf("DelayExpire(%d): expect ttl %d, got: %d", tt.seconds, tt.wantTTL, ttl)
+		}
+	}
+
+	extendTests := []struct {
+		d       time.Duration
+		wantErr bool
+	}{
+		{d: 0, wantErr: true},
+		{d: -time.Second, wantErr: true},
+		{d: 500 * time.Microsecond, wantErr: true},
+		{d: math.MinInt64, wantErr: true},
+		{d: math.MaxInt64},
+	}
+	for _, tt := range extendTests {
+		before, _ := client.PTTL(ctx, lock.getLockKey())
+		err := lock.Extend(ctx, tt.d)
+		after, _ := client.PTTL(ctx, lock.getLockKey())
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidExpire) || after != before {
+				t.Errorf("Extend(%v): expect ErrInvalidExpire without touching ttl, got: %v, ttl %d -> %d", tt.d, err, before, after)
+			}
+			continue
+		}
+		if err != nil || after != tt.d.Milliseconds() {
+			t.Errorf("Extend(%v): expect ttl %d, got: %d, err: %v", tt.d, tt.d.Milliseconds(), after, err)
+		}
+	}
+
+	// 可重入锁的续期脚本同样拒绝非正时长
+	reentrant := NewRedisLock("reentrant_key", client, WithReentrant(), WithExpireSeconds(10))
+	if err := reentrant.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []int64{0, -1} {
+		reply, err := client.Eval(ctx, LuaReentrantExpire, 1, lockScriptArgs(reentrant.getLockKey(), reentrant.token, ms))
+		if err != nil || reply.(int64) != 0 {
+			t.Errorf("expect reentrant expire to reject %dms, got: %v, %v", ms, reply, err)
+		}
+	}
+	if ttl, _ := client.PTTL(ctx, reentrant.getLockKey()); ttl != 10000 {
+		t.Errorf("reentrant lock should keep its ttl, got: %d", ttl)
+	}
+}
+
+// WithOwnerDiagnostics 下各取锁路径失败时均返回包含持有者 token 的 *LockHeldError，持有者附带的元数据不计入 token
+func Test_OwnerDiagnosticsPaths(t *testing.T) {
+	client := NewFakeClient()
+	ctx := context.Background()
+
+	holder := NewRedisLock("test_key", client, WithToken("owner1"), WithMetadata(map[string]string{"host": "host1"}), WithExpireSeconds(10))
+	if err := holder.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []LockOption
+	}{
+		{name: "non-blocking"},
+		{name: "max retries", opts: []LockOption{WithBlock(), WithMaxRetries(2), WithPollInterval(10 * time.Millisecond)}},
+		{name: "block waiting timeout", opts: []LockOption{WithBlock(), WithBlockWaitingSeconds(1), WithPollInterval(100 * time.Millisecond)}},
+	}
+	for _, tt := range tests {
+		lock := NewRedisLock("test_key", client, append(tt.opts, WithExpireSeconds(10), WithOwnerDiagnostics())...)
+		err := lock.Lock(ctx)
+		var heldErr *LockHeldError
+		if !errors.Is(err, ErrLockAcquiredByOthers) || !errors.As(err, &heldErr) {
+			t.Errorf("%s: expect LockHeldError, got: %v", tt.name, err)
+			continue
+		}
+		if heldErr.Owner != "owner1" || heldErr.Key != holder.getLockKey() {
+			t.Errorf("%s: unexpected holder: %+v", tt.name, heldErr)
+		}
+	}
+
+	// TryLock 仍将锁被持有视为 (false, nil)
+	lock := NewRedisLock("test_key", client, WithExpireSeconds(10), WithOwnerDiagnostics())
+	if acquired, err := lock.TryLock(ctx); acquired || err != nil {
+		t.Errorf("expect TryLock (false, nil), got: %v, %v", acquired, err)
+	}
+
+	// 锁释放后正常取锁
+	if err := holder.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Lock(ctx); err != nil {
+		t.Errorf("expect Lock to succeed on a free lock, got: %v", err)
+	}
+	_ = lock.Unlock(ctx)
+}
@@ -3,43 +3,158 @@ package redislock
 import (
 	"context"
 	"errors"
+	"fmt"
+	"redis_lock/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 单节点超时时间
 const DefaultSingleLockTimeout = 50 * time.Millisecond
 
+// 时钟漂移：默认按锁过期时间的 1% 再加 2ms 估算各节点之间的时钟漂移
+const (
+	DefaultDriftFactor   = 0.01
+	DefaultDriftConstant = 2 * time.Millisecond
+)
+
+// 释放成功的节点数未达到 quorum
+var ErrQuorumUnlockFailed = errors.New("unlock failed, quorum of nodes not released")
+
+// 红锁错误，errors.Is 可匹配 sentinel，Error() 中汇总各节点的错误便于排查
+type redLockError struct {
+	sentinel error
+	errs     []error
+}
+
+func (e *redLockError) Error() string {
+	msgs := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%v: [%s]", e.sentinel, strings.Join(msgs, "; "))
+}
+
+func (e *redLockError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// 各节点的错误，支持 errors.Is/As 逐个匹配
+func (e *redLockError) Unwrap() []error {
+	return e.errs
+}
+
 type RedLock struct {
 	RedLockOptions
 
-	locks []*RedisLock //  一组redis 锁结点
+	locks    []*RedisLock    //  一组redis 锁结点
+	clients  []LockClient    // 每个锁结点对应的客户端，用于健康检查
+	owned    []*Client       // NewRedLock 创建的客户端，红锁关闭时关闭其连接池
+	addrs    []string        // 每个锁结点的地址，用于健康检查
+	timeouts []time.Duration // 每个锁结点的超时时间，未单独指定的节点为 singleNodesTimeout
+	down     []int32         // 每个锁结点是否被健康检查标记为下线，下线的节点在加锁、续约时被跳过
 
-	logger
+	// mu 保护看门狗状态，用户的 Lock/Unlock 与看门狗协程(续约失败时解锁)均会修改
+	mu      sync.Mutex
+	stopDog context.CancelFunc // 停止看门狗，非空代表看门狗正在运行
+	errCh   chan error         // 看门狗多数派续约失败的错误通道，看门狗退出时关闭
+	dogDone chan struct{}      // 看门狗协程完全退出时关闭
 }
 
 func NewRedLock(key string, confs []*SingleNodeConf, opts ...RedLockOption) (*RedLock, error) {
-	// 三个以上节点，红锁才有意义
-	if len(confs) < 3 {
-		return nil, errors.New("can not use redLock less than 3 nodes")
+	if len(confs) == 0 {
+		return nil, errors.New("can not use redLock without nodes")
+	}
+
+	// 根据传入的 confs，为每个节点创建客户端，红锁关闭时一并关闭
+	clients := make([]LockClient, 0, len(confs))
+	owned := make([]*Client, 0, len(confs))
+	addrs := make([]string, 0, len(confs))
+	timeouts := make([]time.Duration, 0, len(confs))
+	for _, conf := range confs {
+		client := NewClient(conf.Network, conf.Address, conf.Password, conf.Opts...)
+		clients = append(clients, client)
+		owned = append(owned, client)
+		addrs = append(addrs, conf.Address)
+		timeouts = append(timeouts, conf.Timeout)
+	}
+
+	r, err := newRedLock(key, clients, addrs, timeouts, opts...)
+	if err != nil {
+		for _, client := range owned {
+			client.Close()
+		}
+		return nil, err
+	}
+	r.owned = owned
+	return r, nil
+}
+
+// 基于已创建好的客户端创建红锁，每个客户端对应一个节点，可使用 go-redis 适配器、各节点共享的连接池等
+// 客户端由调用方负责关闭，RedLock.Close 不会关闭它们；多数派、有效期等逻辑与 NewRedLock 一致
+func NewRedLockWithClients(key string, clients []LockClient, opts ...RedLockOption) (*RedLock, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("can not use redLock without nodes")
+	}
+
+	// 外部客户端无法获取地址，以序号标识节点
+	addrs := make([]string, 0, len(clients))
+	for i := range clients {
+		addrs = append(addrs, fmt.Sprintf("node-%d", i))
 	}
+	return newRedLock(key, clients, addrs, make([]time.Duration, len(clients)), opts...)
+}
+
+func newRedLock(key string, clients []LockClient, addrs []string, timeouts []time.Duration, opts ...RedLockOption) (*RedLock, error) {
 	r := RedLock{}
 	for _, opt := range opts {
 		opt(&r.RedLockOptions)
 	}
 
-	repairRedLock(&r.RedLockOptions)
-	if r.expireDuration > 0 && time.Duration(len(confs))*r.singleNodesTimeout*10 > r.expireDuration {
+	repairRedLock(&r.RedLockOptions, timeouts)
+	// 多数派节点数不能超过节点总数，否则永远无法加锁成功
+	if r.quorum > len(clients) {
+		return nil, fmt.Errorf("quorum %d is larger than node count %d", r.quorum, len(clients))
+	}
+	var total time.Duration
+	for _, timeout := range timeouts {
+		total += timeout
+	}
+	if total*10 > r.expireDuration {
 		// 要求所有节点累计的时间 小于 分布式锁过期时间的十分之一
 		return nil, errors.New("expire thresholds of single node is too long")
 	}
 
 	// 0: 初始长度（length）
-	// len(confs): 容量（capacity）
-	r.locks = make([]*RedisLock, 0, len(confs))
-	// 根据传入的 confs，创建 n 个 redis 锁
-	for _, conf := range confs {
-		client := NewClient(conf.Network, conf.Address, conf.Password, conf.Opts...)
-		r.locks = append(r.locks, NewRedisLock(key, client, WithExpireSeconds(int64(r.expireDuration.Seconds()))))
+	// len(clients): 容量（capacity）
+	r.locks = make([]*RedisLock, 0, len(clients))
+	r.clients = clients
+	r.addrs = addrs
+	r.timeouts = timeouts
+	// 所有节点共用同一个 token，保证各节点上的归属权校验、解锁 lua 脚本一致
+	token := utils.NewRandomToken()
+	// 为每个节点创建 redis 锁
+	for _, client := range clients {
+		// 节点锁以红锁的过期时间加锁，续约由红锁看门狗在多数派上统一完成，节点锁自身不启动看门狗
+		lockOpts := []LockOption{WithLogger(r.logger), WithToken(token), WithExpireDuration(r.expireDuration)}
+		r.locks = append(r.locks, NewRedisLock(key, client, lockOpts...))
+	}
+	r.down = make([]int32, len(clients))
+
+	if r.pingOnCreate {
+		var healthy int
+		for _, status := range r.HealthCheck(context.Background()) {
+			if status.Err == nil {
+				healthy++
+				continue
+			}
+			r.logger.Error("红锁节点不可达，标记为下线", "address", status.Address, "err", status.Err)
+		}
+		if healthy < r.quorum {
+			return nil, fmt.Errorf("only %d of %d nodes are reachable, less than quorum %d", healthy, len(clients), r.quorum)
+		}
 	}
 
 	return &r, nil
@@ -47,32 +162,347 @@ func NewRedLock(key string, confs []*SingleNodeConf, opts ...RedLockOption) (*Re
 
 // 加锁，用 successCnt 统计加锁成功的节点
 func (r *RedLock) Lock(ctx context.Context) (err error) {
-	var successCnt int
-	for _, lock := range r.locks {
-		startTime := time.Now()
-		// 为每一个结点，创建一个带超时的 ctx
-		_ctx, cancel := context.WithTimeout(ctx, r.singleNodesTimeout)
-		defer cancel()
-		err := lock.Lock(_ctx)
-		cost := time.Since(startTime)
-		if err == nil && cost <= r.singleNodesTimeout {
-			successCnt++
-		}
+	_, err = r.LockWithValidity(ctx)
+	return err
+}
+
+// 加锁后执行 fn，fn 返回或 panic 时均保证解锁，返回取锁错误或 fn 的错误(fn 成功时返回解锁错误)
+// 传给 fn 的 ctx 派生自调用方 ctx，红锁看门狗续约未取得多数席位(锁已丢失)时会将其取消
+func (r *RedLock) WithLock(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if err = r.Lock(ctx); err != nil {
+		return err
 	}
-	if successCnt < len(r.locks)/2+1 {
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		if unlockErr := r.Unlock(context.Background()); err == nil {
+			err = unlockErr
+		}
+	}()
+	// 红锁看门狗只在多数派续约失败时发送错误，此时锁已丢失
+	go cancelOnLockLost(fnCtx, r.Errors(), func(error) bool { return true }, cancel)
+
+	return fn(fnCtx)
+}
+
+// 加锁，并返回锁的剩余有效期(锁过期时间 - 所有节点加锁的总耗时 - 时钟漂移)，调用方需在有效期内完成临界区操作
+// 取得多数席位但剩余有效期 <= 0 时，同样视为加锁失败
+func (r *RedLock) LockWithValidity(ctx context.Context) (time.Duration, error) {
+	begin := time.Now()
+	successCnt, _ := r.TryLockStatus(ctx)
+
+	if successCnt < r.quorum {
+		r.logger.Error("红锁加锁失败，未取得多数席位", "success", successCnt, "nodes", len(r.locks))
 		// 加锁失败，广播解锁，释放资源
 		r.Unlock(ctx)
-		return errors.New("lock failed, 未取得多数席位")
+		return 0, errors.New("lock failed, 未取得多数席位")
+	}
+
+	validity := r.validity(time.Since(begin))
+	if validity <= 0 {
+		r.logger.Error("红锁加锁失败，扣除加锁耗时与时钟漂移后锁的有效期非正", "elapsed", time.Since(begin), "drift", r.drift())
+		r.Unlock(ctx)
+		return 0, errors.New("lock failed, validity time is not positive")
+	}
+
+	// 加锁成功，启动红锁看门狗
+	r.watchDog()
+	return validity, nil
+}
+
+// 并发地在所有节点上尝试加锁，返回加锁成功的节点数以及每个节点的错误(成功的节点为 nil)，用于排查未取得多数席位的原因
+// 注意：该方法不判断是否取得多数席位，也不会在失败时释放已加锁的节点，调用方需自行 Unlock；业务加锁请使用 Lock
+func (r *RedLock) TryLockStatus(ctx context.Context) (acquired int, perNode []error) {
+	var successCnt int32
+	perNode = make([]error, len(r.locks))
+	// 并发地向所有节点加锁，总耗时取决于最慢的节点，而不是所有节点耗时之和
+	var wg sync.WaitGroup
+	for i, lock := range r.locks {
+		// 跳过被标记为下线的节点
+		if r.isDown(i) {
+			perNode[i] = fmt.Errorf("node %s is marked down", r.addrs[i])
+			continue
+		}
+		wg.Add(1)
+		go func(i int, lock *RedisLock) {
+			defer wg.Done()
+			startTime := time.Now()
+			// 为每一个结点，创建一个带超时的 ctx
+			_ctx, cancel := context.WithTimeout(ctx, r.timeouts[i])
+			defer cancel()
+			err := lock.Lock(_ctx)
+			if cost := time.Since(startTime); err == nil && cost > r.timeouts[i] {
+				err = fmt.Errorf("lock cost %v, exceeds single node timeout %v", cost, r.timeouts[i])
+			}
+			perNode[i] = err
+			if err == nil {
+				atomic.AddInt32(&successCnt, 1)
+			}
+		}(i, lock)
 	}
-	return nil
+	wg.Wait()
+	return int(successCnt), perNode
+}
+
+// 锁的剩余有效期 = 锁的过期时间 - 加锁耗时 - 时钟漂移
+func (r *RedLock) validity(elapsed time.Duration) time.Duration {
+	// 所有节点上的锁过期时间一致，均为红锁的过期时间
+	return r.expireDuration - elapsed - r.drift()
+}
+
+// 时钟漂移 = 锁的过期时间 * driftFactor + driftConstant
+func (r *RedLock) drift() time.Duration {
+	return time.Duration(float64(r.expireDuration)*r.driftFactor) + r.driftConstant
 }
 
-// 解锁，所有节点广播解锁（遍历所有节点）
+// 启动红锁看门狗，周期性地在所有节点上续约
+func (r *RedLock) watchDog() {
+	if !r.watchDogMode {
+		return
+	}
+
+	r.mu.Lock()
+	// 确保在运行的看门狗的唯一性，看门狗已在为该锁续约时无需再次启动
+	if r.stopDog != nil {
+		r.mu.Unlock()
+		return
+	}
+	prevDone := r.dogDone
+	r.mu.Unlock()
+	// 解锁后立即再次加锁时，上一次的看门狗可能仍在退出中(如正在续约)，等待其退出，避免两个看门狗同时续约
+	if prevDone != nil {
+		<-prevDone
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopDog != nil {
+		return
+	}
+	// 与单节点锁一致，看门狗的 ctx 派生自 context.Background()，仅由 Unlock 停止
+	var ctx context.Context
+	ctx, r.stopDog = context.WithCancel(context.Background())
+	errCh := make(chan error, watchDogErrChanSize)
+	r.errCh = errCh
+	done := make(chan struct{})
+	r.dogDone = done
+	go func() {
+		defer close(done)
+		defer func() {
+			close(errCh)
+			// 续约失败自行退出时清理运行状态，保证再次加锁时能重新启动看门狗
+			r.mu.Lock()
+			if r.errCh == errCh && r.stopDog != nil {
+				r.stopDog()
+				r.stopDog = nil
+			}
+			r.mu.Unlock()
+		}()
+		r.runWatchDog(ctx, errCh)
+	}()
+}
+
+func (r *RedLock) runWatchDog(ctx context.Context, errCh chan<- error) {
+	ticker := time.NewTicker(r.watchDogInterval())
+	defer ticker.Stop()
+	for {
+		// Unlock 后立即退出，而不是等到下一次续约时才发现 ctx 已结束
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// extend 中每个节点都使用该节点超时时间的超时 ctx
+		if _, err := r.extend(ctx); err != nil {
+			// 续约期间被 Unlock 停止，不是锁丢失，无需上报
+			if ctx.Err() != nil {
+				return
+			}
+			// 多数派续约失败，锁已丢失，广播解锁释放资源后看门狗退出
+			// Unlock 会先停止看门狗(取消 ctx)，解锁需使用独立的 ctx
+			r.Unlock(context.Background())
+			select {
+			case errCh <- err:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// 红锁看门狗续约间隔，为锁过期时间的三分之一
+func (r *RedLock) watchDogInterval() time.Duration {
+	return r.expireDuration / 3
+}
+
+// 获取红锁看门狗多数派续约失败的错误通道，需在加锁成功后调用
+// 续约未取得多数席位时发送错误并关闭通道；非看门狗模式下返回 nil
+func (r *RedLock) Errors() <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errCh
+}
+
+// 停止红锁看门狗，未启动时为空操作
+func (r *RedLock) stopWatchDog() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopDog == nil {
+		return
+	}
+	r.stopDog()
+	r.stopDog = nil
+}
+
+// 续约，所有节点广播续约，多数节点续约成功才算成功
+// 续约未取得多数席位时，锁已不再安全，广播解锁释放资源并返回错误
+func (r *RedLock) Extend(ctx context.Context) error {
+	_, err := r.ExtendWithValidity(ctx)
+	return err
+}
+
+// 续约，与 Extend 相同，成功时额外返回锁的剩余有效期(锁的过期时间 - 续约耗时 - 时钟漂移)
+// 调用方可据此在锁过期前安排下一次续约，而不是按固定间隔续约；剩余有效期非正时续约失败
+func (r *RedLock) ExtendWithValidity(ctx context.Context) (time.Duration, error) {
+	validity, err := r.extend(ctx)
+	if err != nil {
+		// 锁已不再安全，广播解锁释放资源
+		r.Unlock(ctx)
+	}
+	return validity, err
+}
+
+// 在所有节点上续约，未取得多数席位或剩余有效期非正时返回错误，失败时不解锁
+func (r *RedLock) extend(ctx context.Context) (time.Duration, error) {
+	var successCnt int32
+	begin := time.Now()
+	// 与加锁一样，并发地向所有节点续约，总耗时取决于最慢的节点
+	var wg sync.WaitGroup
+	for i, lock := range r.locks {
+		if r.isDown(i) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, lock *RedisLock) {
+			defer wg.Done()
+			startTime := time.Now()
+			// 为每一个结点创建一个带超时的 ctx
+			_ctx, cancel := context.WithTimeout(ctx, r.timeouts[i])
+			defer cancel()
+			err := lock.delayExpire(_ctx, lock.expireDuration)
+			cost := time.Since(startTime)
+			if err == nil && cost <= r.timeouts[i] {
+				atomic.AddInt32(&successCnt, 1)
+			}
+		}(i, lock)
+	}
+	wg.Wait()
+
+	if int(successCnt) < r.quorum {
+		r.logger.Error("红锁续约失败，未取得多数席位", "success", successCnt, "nodes", len(r.locks))
+		return 0, errors.New("extend failed, 未取得多数席位")
+	}
+
+	validity := r.validity(time.Since(begin))
+	if validity <= 0 {
+		r.logger.Error("红锁续约失败，扣除续约耗时与时钟漂移后锁的有效期非正", "elapsed", time.Since(begin), "drift", r.drift())
+		return 0, errors.New("extend failed, validity time is not positive")
+	}
+	return validity, nil
+}
+
+// 解锁，所有节点并发广播解锁，每个节点的解锁耗时不超过该节点的超时时间
 func (r *RedLock) Unlock(ctx context.Context) error {
+	r.stopWatchDog()
+
+	var successCnt int32
+	var mu sync.Mutex
+	var errs []error
+	// 并发地向所有节点解锁，每个节点使用独立的超时 ctx，单个节点卡住不会拖慢其余节点的释放
+	var wg sync.WaitGroup
+	for i, lock := range r.locks {
+		wg.Add(1)
+		go func(i int, lock *RedisLock) {
+			defer wg.Done()
+			_ctx, cancel := context.WithTimeout(ctx, r.timeouts[i])
+			defer cancel()
+			if err := lock.Unlock(_ctx); err != nil {
+				// 记录各节点的错误，其余节点继续解锁
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("node %s: %w", r.addrs[i], err))
+				mu.Unlock()
+				return
+			}
+			atomic.AddInt32(&successCnt, 1)
+		}(i, lock)
+	}
+	wg.Wait()
+
+	// 多数节点释放成功，锁已不可能再被认为持有，视为解锁成功
+	if int(successCnt) >= r.quorum {
+		return nil
+	}
+	return &redLockError{sentinel: ErrQuorumUnlockFailed, errs: errs}
+}
+
+// 红锁单个节点的健康状态
+type NodeStatus struct {
+	Address string
+	Err     error // nil 代表节点可用
+}
+
+// 并发地 PING 所有节点，返回各节点的健康状态，每个节点使用各自的超时时间
+// 可用于在加锁前发现不可用节点，可用节点数小于 quorum 时加锁必然失败
+// 同时刷新各节点的下线标记：不可达的节点被标记为下线，恢复的节点重新参与加锁
+func (r *RedLock) HealthCheck(ctx context.Context) []NodeStatus {
+	statuses := make([]NodeStatus, len(r.clients))
+	var wg sync.WaitGroup
+	for i, client := range r.clients {
+		wg.Add(1)
+		go func(i int, client LockClient) {
+			defer wg.Done()
+			_ctx, cancel := context.WithTimeout(ctx, r.timeouts[i])
+			defer cancel()
+			err := r.ping(_ctx, i, client)
+			statuses[i] = NodeStatus{Address: r.addrs[i], Err: err}
+			if err != nil {
+				atomic.StoreInt32(&r.down[i], 1)
+			} else {
+				atomic.StoreInt32(&r.down[i], 0)
+			}
+		}(i, client)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// 节点是否被标记为下线
+func (r *RedLock) isDown(i int) bool {
+	return atomic.LoadInt32(&r.down[i]) == 1
+}
+
+// 支持 PING 的客户端
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// 检查节点的连通性，客户端不支持 PING 时以查询锁的 PTTL 代替
+func (r *RedLock) ping(ctx context.Context, i int, client LockClient) error {
+	if p, ok := client.(pinger); ok {
+		return p.Ping(ctx)
+	}
+	_, err := client.PTTL(ctx, r.locks[i].getLockKey())
+	return err
+}
+
+// 关闭 NewRedLock 创建的节点客户端连接池，关闭后红锁不可再使用
+// NewRedLockWithClients 传入的客户端由调用方负责关闭
+func (r *RedLock) Close() error {
 	var err error
-	for _, lock := range r.locks {
-		if _err := lock.Unlock(ctx); _err != nil {
-			// 出现一个错误非空，就去更新错误，并 继续遍历(要继续解锁，不能停止)
+	for _, client := range r.owned {
+		if _err := client.Close(); _err != nil {
 			err = _err
 		}
 	}
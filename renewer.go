@@ -0,0 +1,86 @@
+package redislock
+
+import (
+	"context"
+	"time"
+)
+
+// 续约器，看门狗每个续约间隔调用一次 Renew
+// 默认的续约器基于 DelayExpire 续约，可通过 WithRenewer 替换，例如在续约时同步刷新业务侧的心跳
+type Renewer interface {
+	Renew(ctx context.Context) error
+}
+
+// 函数形式的续约器
+type RenewerFunc func(ctx context.Context) error
+
+func (f RenewerFunc) Renew(ctx context.Context) error {
+	return f(ctx)
+}
+
+// 续约节拍，抽象 time.Ticker 以便测试时注入可手动触发的节拍
+type ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+type timeTicker struct {
+	*time.Ticker
+}
+
+func (t timeTicker) Chan() <-chan time.Time {
+	return t.C
+}
+
+func newTimeTicker(d time.Duration) ticker {
+	return timeTicker{time.NewTicker(d)}
+}
+
+// 续约循环：每个节拍调用一次续约器，续约失败时通过 onErr 上报，ctx 结束时退出
+type renewLoop struct {
+	renewer   Renewer
+	interval  time.Duration
+	immediate bool // 启动后立即续约一次，而不是等待一个完整的续约间隔
+	newTicker func(d time.Duration) ticker
+	onErr     func(err error)
+}
+
+func (l *renewLoop) run(ctx context.Context) {
+	newTicker := l.newTicker
+	if newTicker == nil {
+		newTicker = newTimeTicker
+	}
+	t := newTicker(l.interval)
+	defer t.Stop()
+
+	if l.immediate && !l.renewOnce(ctx) {
+		return
+	}
+	for {
+		// 看门狗停止时立即退出，而不是等到下一次续约
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.Chan():
+		}
+		if !l.renewOnce(ctx) {
+			return
+		}
+	}
+}
+
+// 续约一次，续约失败时上报错误；ctx 已结束时返回 false
+func (l *renewLoop) renewOnce(ctx context.Context) bool {
+	// 节拍与停止信号同时就绪时 select 随机选择，续约前再次检查，保证停止后不再续约
+	if ctx.Err() != nil {
+		return false
+	}
+	if err := l.renewer.Renew(ctx); err != nil {
+		// 续约期间看门狗被停止(已解锁)，续约失败是预期的，不上报
+		if ctx.Err() != nil {
+			return false
+		}
+		l.onErr(err)
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package redislock
+
+import (
+	"context"
+	"fmt"
+)
+
+// 读写锁中读锁、写锁 key 的后缀，key 以 {key} 的 hash tag 形式拼接，保证 cluster 模式下读写锁位于同一槽位
+const (
+	rwReadKeySuffix  = ":read"
+	rwWriteKeySuffix = ":write"
+)
+
+// 基于 redis 实现的分布式读写锁：读锁共享、写锁独占
+// 写锁以 string 存储 token；读锁以 hash 存储 token -> 重入次数，同一 token 可重入加读锁
+// 写者需等待所有读者释放，读者需等待写者释放；持有写锁的 token 可以再加读锁(锁降级)
+// 读锁、写锁分别复用 RedisLock 的阻塞重试、看门狗续约逻辑
+// 注意：所有读者共用读锁 hash 的过期时间，只要仍有读者在续约，已崩溃读者的记录会一直保留到所有读者释放
+type RWRedisLock struct {
+	readLock  *RedisLock
+	writeLock *RedisLock
+}
+
+// opts 同时作用于读锁与写锁，读锁总是可重入的，写锁总是不可重入的(忽略 WithReentrant)
+func NewRWRedisLock(key string, client LockClient, opts ...LockOption) *RWRedisLock {
+	var o LockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	repairLock(&o)
+
+	// 读锁、写锁共用同一个 token，保证持有写锁时可以加读锁
+	opts = append(opts, WithToken(o.token))
+	key = "{" + key + "}"
+	return &RWRedisLock{
+		readLock:  NewRedisLock(key+rwReadKeySuffix, client, append(opts, WithReentrant())...),
+		writeLock: NewRedisLock(key+rwWriteKeySuffix, client, append(opts, func(lo *LockOptions) { lo.reentrant = false })...),
+	}
+}
+
+// 加读锁，存在写者时按照阻塞配置等待
+func (r *RWRedisLock) RLock(ctx context.Context) error {
+	return r.readLock.lock(ctx, r.tryRLock)
+}
+
+// 释放读锁，当前 token 的重入次数归零时才真正释放并关闭读锁的看门狗
+func (r *RWRedisLock) RUnlock(ctx context.Context) (err error) {
+	lock := r.readLock
+	defer func() {
+		lock.metrics.OnUnlock(err == nil)
+	}()
+
+	keyAndArgs := []interface{}{lock.getLockKey(), lock.token}
+	reply, err := lock.client.Eval(ctx, LuaRWReadUnlock, 1, keyAndArgs)
+	if err != nil {
+		// 请求失败时服务端的重入次数可能仍大于 0，看门狗继续续约
+		return err
+	}
+
+	ret, _ := reply.(int64)
+	// 仍有剩余重入次数，读锁未释放，看门狗继续续约
+	if ret > 0 {
+		return nil
+	}
+
+	lock.stopWatchDog()
+	if ret < 0 {
+		return fmt.Errorf("can not unlock read lock without ownership of lock: %w", ErrLockNotHeld)
+	}
+	return nil
+}
+
+// 加写锁，存在读者或其他写者时按照阻塞配置等待
+func (r *RWRedisLock) Lock(ctx context.Context) error {
+	return r.writeLock.lock(ctx, r.tryWLock)
+}
+
+// 释放写锁
+func (r *RWRedisLock) Unlock(ctx context.Context) error {
+	return r.writeLock.Unlock(ctx)
+}
+
+// 读锁看门狗续约失败的错误通道
+func (r *RWRedisLock) RErrors() <-chan error {
+	return r.readLock.Errors()
+}
+
+// 写锁看门狗续约失败的错误通道
+func (r *RWRedisLock) Errors() <-chan error {
+	return r.writeLock.Errors()
+}
+
+func (r *RWRedisLock) tryRLock(ctx context.Context) error {
+	lock := r.readLock
+	keyAndArgs := []interface{}{r.writeLock.getLockKey(), lock.getLockKey(), lock.token, luaInt(lock.expireDuration.Milliseconds())}
+	return r.eval(ctx, lock, LuaRWReadLock, keyAndArgs)
+}
+
+func (r *RWRedisLock) tryWLock(ctx context.Context) error {
+	lock := r.writeLock
+	keyAndArgs := []interface{}{lock.getLockKey(), r.readLock.getLockKey(), lock.token, luaInt(lock.expireDuration.Milliseconds())}
+	return r.eval(ctx, lock, LuaRWWriteLock, keyAndArgs)
+}
+
+// 执行读写锁的取锁脚本，返回值非 1 时视为锁被他人持有(可重试)
+func (r *RWRedisLock) eval(ctx context.Context, lock *RedisLock, script string, keyAndArgs []interface{}) error {
+	reply, err := lock.client.Eval(ctx, script, 2, keyAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		lock.metrics.OnContention()
+		return fmt.Errorf("lock %s is held by others: %w", lock.getLockKey(), ErrLockAcquiredByOthers)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package redislock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 基于 redis sorted set 实现的分布式计数信号量，最多允许 limit 个 token 同时持有
+// 每个持有者以其过期时间戳作为 score，加锁时由 lua 脚本原子地清理过期持有者并判断是否还有空位
+// 阻塞重试、取锁超时、监控指标等复用 RedisLock 的实现；看门狗模式下周期性地刷新持有者的过期时间
+type Semaphore struct {
+	limit        int
+	lock         *RedisLock // 复用 RedisLock 的取锁流程，其自身的看门狗不启用
+	watchDogMode bool
+
+	// mu 保护看门狗状态，Acquire/Release 与看门狗协程均会修改
+	mu      sync.Mutex
+	stopDog context.CancelFunc // 停止看门狗，非空代表看门狗正在运行
+	errCh   chan error         // 看门狗续期失败的错误通道，看门狗退出时关闭
+	dogDone chan struct{}      // 看门狗协程完全退出时关闭
+}
+
+// 创建信号量，limit <= 0 时使用 1(即退化为互斥锁)，opts 与 RedisLock 一致(WithReentrant 无效)
+func NewSemaphore(key string, limit int, client LockClient, opts ...LockOption) *Semaphore {
+	lock := NewRedisLock(key, client, opts...)
+	if limit <= 0 {
+		lock.logger.Error("信号量 limit 不合法，使用默认值 1", "limit", limit)
+		limit = 1
+	}
+
+	s := Semaphore{
+		limit:        limit,
+		lock:         lock,
+		watchDogMode: lock.watchDogMode,
+	}
+	// 信号量的续期由 Semaphore 自身的看门狗完成
+	lock.watchDogMode = false
+	return &s
+}
+
+// 获取信号量，没有空位时按照阻塞配置等待；已持有时再次获取只刷新过期时间，不会重复启动看门狗
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if err := s.lock.lock(ctx, s.tryAcquire); err != nil {
+		return err
+	}
+	s.watchDog()
+	return nil
+}
+
+// 释放信号量，不再是持有者(未获取或已过期)时返回 ErrLockNotHeld
+func (s *Semaphore) Release(ctx context.Context) (err error) {
+	defer func() {
+		s.lock.metrics.OnUnlock(err == nil)
+	}()
+	s.stopWatchDog()
+
+	reply, err := s.lock.client.Eval(ctx, LuaSemaphoreRelease, 1, []interface{}{s.lock.getLockKey(), s.lock.token})
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		return fmt.Errorf("can not release semaphore without holding it: %w", ErrLockNotHeld)
+	}
+	return nil
+}
+
+// 获取看门狗续期失败的错误通道，非看门狗模式下返回 nil
+func (s *Semaphore) Errors() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errCh
+}
+
+func (s *Semaphore) tryAcquire(ctx context.Context) error {
+	keyAndArgs := lockScriptArgs(s.lock.getLockKey(), s.lock.token, int64(s.limit), s.lock.expireDuration.Milliseconds())
+	reply, err := s.lock.client.Eval(ctx, LuaSemaphoreAcquire, 1, keyAndArgs)
+	if err != nil {
+		return err
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		s.lock.metrics.OnContention()
+		return fmt.Errorf("semaphore %s is full: %w", s.lock.getLockKey(), ErrLockAcquiredByOthers)
+	}
+	return nil
+}
+
+// 刷新持有者的过期时间
+func (s *Semaphore) refresh(ctx context.Context, expire time.Duration) error {
+	reply, err := s.lock.client.Eval(ctx, LuaSemaphoreRefresh, 1, lockScriptArgs(s.lock.getLockKey(), s.lock.token, expire.Milliseconds()))
+	if err != nil {
+		s.lock.metrics.OnRenew(false)
+		return &renewError{cause: err}
+	}
+	if ret, _ := reply.(int64); ret != 1 {
+		s.lock.metrics.OnRenew(false)
+		return &renewError{cause: fmt.Errorf("can not refresh semaphore without holding it: %w", ErrLockNotHeld)}
+	}
+	s.lock.metrics.OnRenew(true)
+	return nil
+}
+
+// 启动看门狗，与 RedisLock 一致，ctx 派生自 watchDogCtx，由 Release 停止
+func (s *Semaphore) watchDog() {
+	if !s.watchDogMode {
+		return
+	}
+
+	s.mu.Lock()
+	// 已持有信号量时再次 Acquire 只会刷新过期时间，看门狗已在续期，无需再次启动
+	if s.stopDog != nil {
+		s.mu.Unlock()
+		return
+	}
+	prevDone := s.dogDone
+	s.mu.Unlock()
+	// 释放后立即再次获取时，等待上一次的看门狗退出，避免两个看门狗同时续期
+	if prevDone != nil {
+		<-prevDone
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopDog != nil {
+		return
+	}
+	var ctx context.Context
+	ctx, s.stopDog = context.WithCancel(s.lock.watchDogCtx)
+	errCh := make(chan error, s.lock.errBufferSize)
+	s.errCh = errCh
+	done := make(chan struct{})
+	s.dogDone = done
+	go func() {
+		defer close(done)
+		defer func() {
+			close(errCh)
+			// 看门狗随 watchDogCtx 结束而退出时，清理运行状态，保证再次获取时能重新启动看门狗
+			s.mu.Lock()
+			if s.errCh == errCh && s.stopDog != nil {
+				s.stopDog()
+				s.stopDog = nil
+			}
+			s.mu.Unlock()
+		}()
+		s.runWatchDog(ctx, errCh)
+	}()
+}
+
+func (s *Semaphore) runWatchDog(ctx context.Context, errCh chan error) {
+	loop := renewLoop{
+		renewer: RenewerFunc(func(ctx context.Context) error {
+			return s.refresh(ctx, s.lock.renewExpireDuration())
+		}),
+		interval:  s.lock.watchDogInterval,
+		newTicker: s.lock.newTicker,
+		onErr: func(err error) {
+			sendErr(errCh, err, s.lock.errDropPolicy)
+		},
+	}
+	loop.run(ctx)
+}
+
+// 停止看门狗，未启动时为空操作
+func (s *Semaphore) stopWatchDog() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopDog == nil {
+		return
+	}
+	s.stopDog()
+	s.stopDog = nil
+}
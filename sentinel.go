@@ -0,0 +1,101 @@
+package redislock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// 创建哨兵模式的 Client，每次建立新连接时通过哨兵解析当前主节点地址
+// 主从切换后，旧主节点上的连接在从连接池借出时会因角色校验失败被丢弃，并重新解析主节点建立连接
+// 主节点的密码等参数通过 WithPassword 等选项指定
+func NewSentinelClient(masterName string, sentinelAddrs []string, opts ...ClientOption) (*Client, error) {
+	if masterName == "" {
+		return nil, errors.New("sentinel master name is empty")
+	}
+	if len(sentinelAddrs) == 0 {
+		return nil, errors.New("sentinel addresses are empty")
+	}
+
+	c := Client{
+		ClientOptions: ClientOptions{
+			network:       "tcp",
+			masterName:    masterName,
+			sentinelAddrs: sentinelAddrs,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&c.ClientOptions)
+	}
+
+	repairClient(&c.ClientOptions)
+	if c.ClientOptions.err != nil {
+		return nil, c.ClientOptions.err
+	}
+
+	// 与 NewClient 一致，Close 时关闭自己创建的连接池
+	return c.newClient(), nil
+}
+
+// 依次询问哨兵，获取当前主节点地址，返回第一个成功的结果
+func (c *Client) resolveMaster() (string, error) {
+	var dialOption []redis.DialOption
+	if c.dialTimeout > 0 {
+		dialOption = append(dialOption, redis.DialConnectTimeout(c.dialTimeout))
+	}
+	if c.readTimeout > 0 {
+		dialOption = append(dialOption, redis.DialReadTimeout(c.readTimeout))
+	}
+
+	var err error
+	for _, sentinelAddr := range c.sentinelAddrs {
+		var address string
+		if address, err = getMasterAddrFromSentinel(sentinelAddr, c.masterName, dialOption...); err == nil {
+			return address, nil
+		}
+		c.logger.Error("哨兵查询主节点失败", "sentinel", sentinelAddr, "err", err)
+	}
+	return "", fmt.Errorf("no sentinel resolved master %q: %w", c.masterName, err)
+}
+
+// SENTINEL get-master-addr-by-name 返回主节点的 ip 与端口
+func getMasterAddrFromSentinel(sentinelAddr, masterName string, dialOption ...redis.DialOption) (string, error) {
+	conn, err := redis.DialContext(context.Background(), "tcp", sentinelAddr, dialOption...)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	res, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", masterName))
+	if err != nil {
+		return "", err
+	}
+	if len(res) != 2 {
+		return "", fmt.Errorf("unexpected sentinel reply: %v", res)
+	}
+	return net.JoinHostPort(res[0], res[1]), nil
+}
+
+// 校验连接的节点角色为主节点(ROLE 返回的第一个元素为 master)
+func checkMasterRole(conn redis.Conn) error {
+	reply, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return errors.New("empty ROLE reply")
+	}
+	role, err := redis.String(reply[0], nil)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(role, "master") {
+		return fmt.Errorf("redis node role is %s, not master", role)
+	}
+	return nil
+}
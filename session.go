@@ -0,0 +1,82 @@
+package redislock
+
+import (
+	"context"
+	"sync"
+)
+
+// 锁会话：持有锁期间有效的 ctx，锁丢失时该 ctx 立即被取消
+// 业务方在 Context() 下执行任务，锁丢失时任务随之中止，任务结束后调用 Close 释放锁
+type Session struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	unlock func(ctx context.Context) error
+
+	once     sync.Once
+	closeErr error
+}
+
+// 加锁并创建会话，会话 ctx 派生自调用方 ctx
+// 看门狗模式(或开启 WithOwnershipMonitor)下，发现锁已不再持有(ErrLockNotHeld)时取消会话 ctx
+// 其余模式下锁不会续约，会话 ctx 在锁的过期时间到达时取消
+// 会话通过 Errors() 监听锁的丢失，会话期间业务方不应再读取 lock.Errors()
+func NewSession(ctx context.Context, lock *RedisLock) (*Session, error) {
+	if err := lock.Lock(ctx); err != nil {
+		return nil, err
+	}
+
+	errCh := lock.Errors()
+	if errCh == nil {
+		deadline, _ := lock.Deadline()
+		sessionCtx, cancel := context.WithDeadline(ctx, deadline)
+		return newSession(sessionCtx, cancel, lock.Unlock), nil
+	}
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	go cancelOnLockLost(sessionCtx, errCh, IsLockNotHeld, cancel)
+	return newSession(sessionCtx, cancel, lock.Unlock), nil
+}
+
+// 加红锁并创建会话，会话 ctx 派生自调用方 ctx
+// 看门狗模式(WithRedLockWatchDog)下，续约未取得多数席位时取消会话 ctx
+// 非看门狗模式下，会话 ctx 在锁的剩余有效期结束时取消
+func NewRedLockSession(ctx context.Context, redLock *RedLock) (*Session, error) {
+	validity, err := redLock.LockWithValidity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	errCh := redLock.Errors()
+	if errCh == nil {
+		sessionCtx, cancel := context.WithTimeout(ctx, validity)
+		return newSession(sessionCtx, cancel, redLock.Unlock), nil
+	}
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	// 红锁看门狗只在多数派续约失败时发送错误，此时锁已丢失
+	go cancelOnLockLost(sessionCtx, errCh, func(error) bool { return true }, cancel)
+	return newSession(sessionCtx, cancel, redLock.Unlock), nil
+}
+
+func newSession(ctx context.Context, cancel context.CancelFunc, unlock func(ctx context.Context) error) *Session {
+	return &Session{
+		ctx:    ctx,
+		cancel: cancel,
+		unlock: unlock,
+	}
+}
+
+// 会话 ctx，锁丢失、调用方 ctx 结束或会话关闭时被取消
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// 关闭会话：取消会话 ctx 并释放锁，可重复调用，只有首次调用会解锁
+// 调用方 ctx 可能已取消，解锁使用独立的 ctx，保证锁一定被释放
+func (s *Session) Close() error {
+	s.once.Do(func() {
+		s.cancel()
+		s.closeErr = s.unlock(context.Background())
+	})
+	return s.closeErr
+}
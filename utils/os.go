@@ -30,20 +30,32 @@ func GetCurrentGoroutineID() string {
 	// 它返回实际写入 buf 的字节数。
 	buf = buf[:runtime.Stack(buf, false)]
 
-	// 将字节切片转换为字符串，以便进行字符串操作。
-	stackInfo := string(buf)
-
-	// 从堆栈信息字符串中提取 Goroutine ID。
-	// 堆栈信息通常以 "goroutine 12345 [running]:" 这样的格式开始。
-	// 1. strings.Split(stackInfo, "[running]")[0]:
-	//    - 以 "[running]" 为分隔符将字符串分割。
-	//    - 取第一个部分，即 "goroutine 12345 "（注意后面有个空格）。
-	// 2. strings.Split(..., "goroutine")[1]:
-	//    - 以 "goroutine" 为分隔符将上一步的结果分割。
-	//    - 取第二个部分，即 " 12345 "（注意前后都有空格）。
-	// 3. strings.TrimSpace(...):
-	//    - 去除字符串两端的空格，得到纯粹的 Goroutine ID，例如 "12345"。
-	return strings.TrimSpace(strings.Split(strings.Split(stackInfo, "[running]")[0], "goroutine")[1])
+	// 从堆栈信息中解析 Goroutine ID
+	return parseGoroutineID(string(buf))
+}
+
+// 解析失败时使用的 Goroutine ID
+const unknownGoroutineID = "unknown"
+
+// parseGoroutineID 从堆栈信息中提取 Goroutine ID
+// 堆栈信息通常以 "goroutine 12345 [running]:" 这样的格式开始，但方括号内的状态并不固定，
+// 例如 "[running, locked to thread]"，因此不依赖状态字符串，而是按字段扫描首行：
+// 第一个字段为 "goroutine"，第二个字段为纯数字的 ID
+// 解析失败时返回 unknownGoroutineID，而不是 panic
+func parseGoroutineID(stackInfo string) string {
+	// 只取首行，例如 "goroutine 12345 [running]:"
+	if idx := strings.IndexByte(stackInfo, '\n'); idx >= 0 {
+		stackInfo = stackInfo[:idx]
+	}
+
+	fields := strings.Fields(stackInfo)
+	if len(fields) < 2 || fields[0] != "goroutine" {
+		return unknownGoroutineID
+	}
+	if _, err := strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return unknownGoroutineID
+	}
+	return fields[1]
 }
 
 // GetProcessAndGoroutineIDStr 获取当前进程 ID 和 Goroutine ID 的组合字符串
@@ -0,0 +1,41 @@
+package utils
+
+import "testing"
+
+func Test_parseGoroutineID(t *testing.T) {
+	cases := []struct {
+		stack  string
+		expect string
+	}{
+		{"goroutine 1 [running]:\nmain.main()\n", "1"},
+		{"goroutine 12345 [running, locked to thread]:\nruntime.Stack()\n", "12345"},
+		{"goroutine 7 [syscall, 2 minutes]:\n", "7"},
+		{"goroutine 42 gp=0xc000007c00 m=0 mp=0x5b7e00 [running]:\n", "42"},
+		{"goroutine 99 [runn", "99"},
+		{"", unknownGoroutineID},
+		{"goroutine", unknownGoroutineID},
+		{"goroutine abc [running]:\n", unknownGoroutineID},
+		{"panic: something\ngoroutine 1 [running]:\n", unknownGoroutineID},
+	}
+	for _, c := range cases {
+		if got := parseGoroutineID(c.stack); got != c.expect {
+			t.Errorf("parseGoroutineID(%q): expect %q, got: %q", c.stack, c.expect, got)
+		}
+	}
+}
+
+func Test_GetCurrentGoroutineID(t *testing.T) {
+	if id := GetCurrentGoroutineID(); id == unknownGoroutineID {
+		t.Errorf("expect a numeric goroutine id, got: %q", id)
+	}
+}
+
+func Test_NewRandomToken(t *testing.T) {
+	token := NewRandomToken()
+	if len(token) != 36 || token[14] != '4' {
+		t.Errorf("expect a version 4 uuid, got: %q", token)
+	}
+	if NewRandomToken() == token {
+		t.Error("expect different tokens")
+	}
+}
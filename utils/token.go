@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// NewRandomToken 基于 crypto/rand 生成随机的 UUID(v4)，作为默认的锁 token
+// 与 Goroutine ID 不同，随机 token 不会因协程退出后 ID 被复用而发生碰撞
+func NewRandomToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// 系统随机源不可用时退化为 进程 ID + Goroutine ID + 纳秒时间戳
+		return fmt.Sprintf("%s_%d", GetProcessAndGoroutineIDStr(), time.Now().UnixNano())
+	}
+	// 设置 UUID 的版本号(4)与变体(RFC 4122)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
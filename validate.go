@@ -0,0 +1,185 @@
+package redislock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// 配置校验错误，汇总校验发现的所有问题，errors.Is 可匹配其中任一问题包装的错误(如 ErrInvalidExpire)
+type ConfigError struct {
+	Issues []error
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		msgs = append(msgs, issue.Error())
+	}
+	return fmt.Sprintf("invalid lock config: [%s]", strings.Join(msgs, "; "))
+}
+
+func (e *ConfigError) Is(target error) bool {
+	for _, issue := range e.Issues {
+		if errors.Is(issue, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// 收集校验问题，没有问题时返回 nil
+type configIssues []error
+
+func (c *configIssues) add(format string, args ...any) {
+	*c = append(*c, fmt.Errorf(format, args...))
+}
+
+func (c configIssues) err() error {
+	if len(c) == 0 {
+		return nil
+	}
+	return &ConfigError{Issues: c}
+}
+
+// 不连接 redis，检查锁选项的组合是否矛盾或危险，返回包含所有问题的 *ConfigError，没有问题时返回 nil
+// 校验基于用户指定的原始选项，会报告 NewRedisLock 静默修正的配置(如续约间隔不小于过期时间)，适合在服务启动时调用
+func ValidateLockOptions(opts ...LockOption) error {
+	var lo LockOptions
+	for _, opt := range opts {
+		opt(&lo)
+	}
+
+	var issues configIssues
+	if lo.expireSet && lo.expireDuration <= 0 {
+		issues.add("%w, got: %v", ErrInvalidExpire, lo.expireDuration)
+	}
+	if !lo.expireAt.IsZero() {
+		if lo.expireSet {
+			issues.add("expire at %v overrides expire duration %v", lo.expireAt, lo.expireDuration)
+		}
+		if !lo.expireAt.After(time.Now()) {
+			issues.add("%w: %v", ErrExpireAtPassed, lo.expireAt)
+		}
+	}
+
+	// 与 repairLock 一致：未指定过期时间、未关闭看门狗时进入看门狗模式
+	watchDogMode := lo.expireAt.IsZero() && !lo.expireSet && lo.expireDuration <= 0 && !lo.noWatchDog
+	if watchDogMode {
+		expire, interval := DefaultLockExpireSeconds*time.Second, lo.watchDogInterval
+		if interval <= 0 {
+			interval = DefaultWatchDogInterval
+		}
+		if interval >= expire {
+			issues.add("watchdog interval %v is not less than lock expire %v, the lock expires before renewal", interval, expire)
+		}
+		if lo.renewJitter > interval {
+			issues.add("renew jitter %v is larger than watchdog interval %v", lo.renewJitter, interval)
+		}
+		if lo.monitorInterval > 0 {
+			issues.add("ownership monitor has no effect in watchdog mode")
+		}
+	} else {
+		if lo.watchDogInterval > 0 {
+			issues.add("watchdog interval %v has no effect, watchdog is disabled by an explicit expire or WithNoWatchDog", lo.watchDogInterval)
+		}
+		if lo.monitorInterval > 0 && lo.expireDuration > 0 && lo.monitorInterval >= lo.expireDuration {
+			issues.add("ownership monitor interval %v is not less than lock expire %v, lock loss is detected after expiry", lo.monitorInterval, lo.expireDuration)
+		}
+	}
+
+	if lo.isBlock {
+		wait := time.Duration(lo.blockWaitingSeconds) * time.Second
+		if wait <= 0 {
+			wait = 5 * time.Second
+		}
+		poll := lo.pollInterval
+		if poll <= 0 {
+			poll = DefaultPollInterval
+		}
+		if poll >= wait {
+			issues.add("poll interval %v is not less than blocking wait %v, waiters retry at most once", poll, wait)
+		}
+	} else {
+		if lo.blockWaitingSeconds > 0 {
+			issues.add("blocking wait %ds has no effect without WithBlock", lo.blockWaitingSeconds)
+		}
+		if lo.maxRetries > 0 {
+			issues.add("max retries %d has no effect without WithBlock", lo.maxRetries)
+		}
+	}
+
+	if lo.backoffInitial > 0 {
+		if lo.backoffFactor != 0 && lo.backoffFactor < 1 {
+			issues.add("backoff factor %v is less than 1", lo.backoffFactor)
+		}
+		if lo.backoffMax > 0 && lo.backoffMax < lo.backoffInitial {
+			issues.add("backoff max %v is less than backoff initial %v", lo.backoffMax, lo.backoffInitial)
+		}
+	}
+	if lo.notifyChannel != nil && !lo.notifyWait {
+		issues.add("notify channel has no effect without WithNotifyWait")
+	}
+	if lo.fairQueue && lo.reentrant {
+		issues.add("fair queue has no effect on a reentrant lock")
+	}
+	if lo.replicaWait > 0 && (lo.reentrant || lo.acquireScript != "") {
+		issues.add("replication wait only applies to the default SET NX acquisition")
+	}
+	if lo.nonAtomicUnlock {
+		issues.add("non-atomic unlock may delete a lock acquired by others after expiry")
+	}
+	return issues.err()
+}
+
+// 不连接 redis，检查红锁的节点与选项，返回包含所有问题的 *ConfigError，没有问题时返回 nil
+// 除 NewRedLock 会拒绝的配置(节点超时之和超过过期时间的十分之一、quorum 大于节点数)外，
+// 还会报告扣除节点超时与时钟漂移后有效期非正、quorum 未达到多数派等危险配置
+func ValidateRedLockOptions(confs []*SingleNodeConf, opts ...RedLockOption) error {
+	var issues configIssues
+	if len(confs) == 0 {
+		issues.add("can not use redLock without nodes")
+		return issues.err()
+	}
+
+	var o RedLockOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.expireDuration < 0 {
+		issues.add("%w, got: %v", ErrInvalidExpire, o.expireDuration)
+	}
+	if o.driftFactor < 0 || o.driftConstant < 0 {
+		issues.add("negative clock drift (factor %v, constant %v) is replaced by the default", o.driftFactor, o.driftConstant)
+	}
+
+	timeouts := make([]time.Duration, 0, len(confs))
+	for _, conf := range confs {
+		timeouts = append(timeouts, conf.Timeout)
+	}
+	// 以 NewRedLock 相同的方式补全默认值，校验时不输出日志
+	o.logger = newWriterLogger(io.Discard, LevelError, 0)
+	repairRedLock(&o, timeouts)
+
+	var total time.Duration
+	for _, timeout := range timeouts {
+		total += timeout
+	}
+	if total*10 > o.expireDuration {
+		issues.add("sum of node timeouts %v exceeds a tenth of expire %v", total, o.expireDuration)
+	}
+	drift := time.Duration(float64(o.expireDuration)*o.driftFactor) + o.driftConstant
+	if total+drift >= o.expireDuration {
+		issues.add("validity is never positive: node timeouts %v plus clock drift %v reach expire %v", total, drift, o.expireDuration)
+	}
+
+	nodes := len(confs)
+	if o.quorum > nodes {
+		issues.add("quorum %d is larger than node count %d", o.quorum, nodes)
+	} else if o.quorum <= nodes/2 {
+		issues.add("quorum %d is not a majority of %d nodes, two clients may hold the lock at the same time", o.quorum, nodes)
+	}
+	return issues.err()
+}